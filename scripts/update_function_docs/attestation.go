@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+)
+
+const (
+	// type of the in-toto statements of the attestations
+	attestationType = "https://in-toto.io/Statement/v0.1"
+	// type of the predicate of the attestations, the tool in the repo
+	attestationPredicateType = "https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/scripts/update_function_docs"
+)
+
+// version of the tool, which can be set at build time with
+// -ldflags "-X main.version=<version>"
+var version = ""
+
+// toolVersion returns the version of the tool, from the build info unless it
+// was set at build time
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// attestation is an in-toto statement of a docs update, with the updated docs
+// as its subjects
+type attestation struct {
+	Type          string               `json:"_type"`
+	Subject       []attestationSubject `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     docsUpdatePredicate  `json:"predicate"`
+}
+
+// attestationSubject is an updated doc and the digest of its contents after
+// the update
+type attestationSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// docsUpdatePredicate describes what the docs update did
+type docsUpdatePredicate struct {
+	ToolVersion string `json:"toolVersion"`
+	// Release is <language>/<function>/<version>, as in the Release-Tag
+	// trailer
+	Release string `json:"release"`
+	// ReleaseTag is empty if the version isn't tagged, e.g. for
+	// -target-version
+	ReleaseTag string         `json:"releaseTag,omitempty"`
+	Commit     string         `json:"commit"`
+	Files      []attestedFile `json:"files"`
+}
+
+// attestedFile is an updated doc and the digests of its contents before and
+// after the update
+type attestedFile struct {
+	Path         string `json:"path"`
+	BeforeSHA256 string `json:"beforeSHA256"`
+	AfterSHA256  string `json:"afterSHA256"`
+}
+
+// writeAttestation writes the attestation of the commit of the docs update of
+// the release to path
+func (fr *functionRelease) writeAttestation(path, commit string) error {
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return err
+	}
+	statement := attestation{
+		Type:          attestationType,
+		Subject:       []attestationSubject{},
+		PredicateType: attestationPredicateType,
+		Predicate: docsUpdatePredicate{
+			ToolVersion: toolVersion(),
+			Release:     fmt.Sprintf("%s/%s/%s", fr.Language, fr.FunctionName, fr.LatestPatchVersion),
+			ReleaseTag:  fr.latestTag,
+			Commit:      commit,
+			Files:       []attestedFile{},
+		},
+	}
+	for _, update := range fr.docUpdates {
+		if !update.Updated {
+			continue
+		}
+		// the paths of the docs in the repo, as they're committed
+		name, err := filepath.Rel(repoBase, update.Path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		statement.Subject = append(statement.Subject, attestationSubject{
+			Name:   name,
+			Digest: map[string]string{"sha256": update.AfterSHA256},
+		})
+		statement.Predicate.Files = append(statement.Predicate.Files, attestedFile{
+			Path:         name,
+			BeforeSHA256: update.BeforeSHA256,
+			AfterSHA256:  update.AfterSHA256,
+		})
+	}
+	contents, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(contents, '\n'))
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteAttestation(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "functions", "go", "apply-setters", "README.md")
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.1",
+		latestTag:          "functions/go/apply-setters/v0.2.1",
+		opts:               releaseOptions{RepoDir: dir},
+	}
+	fr.recordDocUpdate(readme, replaceCount{}, true)
+	fr.recordChange(readme, []byte("before\n"), []byte("after\n"))
+	fr.recordDocUpdate(filepath.Join(dir, "examples", "apply-setters-simple", "README.md"), replaceCount{}, false)
+
+	path := filepath.Join(dir, "attestation.json")
+	if err := fr.writeAttestation(path, "1a2b3c"); err != nil {
+		t.Fatal(err)
+	}
+	// written atomically, without leaving the temp file behind
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("expected only the attestation in %s, got %v, %v", dir, entries, err)
+	}
+	var actual attestation
+	if err := json.Unmarshal([]byte(readFile(t, path)), &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := attestation{
+		Type: attestationType,
+		Subject: []attestationSubject{{
+			Name:   "functions/go/apply-setters/README.md",
+			Digest: map[string]string{"sha256": sha256Hex([]byte("after\n"))},
+		}},
+		PredicateType: attestationPredicateType,
+		Predicate: docsUpdatePredicate{
+			ToolVersion: toolVersion(),
+			Release:     "go/apply-setters/v0.2.1",
+			ReleaseTag:  "functions/go/apply-setters/v0.2.1",
+			Commit:      "1a2b3c",
+			Files: []attestedFile{{
+				Path:         "functions/go/apply-setters/README.md",
+				BeforeSHA256: sha256Hex([]byte("before\n")),
+				AfterSHA256:  sha256Hex([]byte("after\n")),
+			}},
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// pattern of remote release branches, e.g. origin/apply-setters/v1.0, or
+// origin/gatekeeper/validate/v1.0 for namespaced functions
+var remoteReleaseBranchPattern = regexp.MustCompile(`^[^/\s]+/([-\w]+(?:/[-\w]+)*)/(v\d+\.\d+)$`)
+
+// releaseAudit is the inconsistencies between the release branches and tags
+type releaseAudit struct {
+	// BranchesWithoutTags are the <function>/<minor> release branches without
+	// a tag of the minor version
+	BranchesWithoutTags []string
+	// TagsWithoutBranches are the <function>/<minor> of tags without a
+	// release branch
+	TagsWithoutBranches []string
+	// MisalignedFunctions have release branches and tags, but no minor
+	// version in common
+	MisalignedFunctions []string
+}
+
+// consistent reports whether no inconsistencies were found
+func (ra releaseAudit) consistent() bool {
+	return len(ra.BranchesWithoutTags) == 0 && len(ra.TagsWithoutBranches) == 0 &&
+		len(ra.MisalignedFunctions) == 0
+}
+
+// auditReleases matches the release branches of git branch -r output with
+// the release tags
+func auditReleases(branches string, tags []string) releaseAudit {
+	// function names to their minor versions
+	branchMinors := map[string]map[string]bool{}
+	for _, line := range strings.Split(branches, "\n") {
+		// skip symbolic refs, e.g. origin/HEAD -> origin/main
+		match := remoteReleaseBranchPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		addMinor(branchMinors, match[1], match[2])
+	}
+	tagMinors := map[string]map[string]bool{}
+	for _, tag := range tags {
+		if candidate, ok := parseReleaseTag(tag); ok {
+			addMinor(tagMinors, candidate.FunctionName, semver.MajorMinor(candidate.PatchVersion))
+		}
+	}
+	var audit releaseAudit
+	audit.BranchesWithoutTags = missingMinors(branchMinors, tagMinors)
+	audit.TagsWithoutBranches = missingMinors(tagMinors, branchMinors)
+	for function, minors := range branchMinors {
+		if _, tagged := tagMinors[function]; !tagged {
+			continue
+		}
+		aligned := false
+		for minor := range minors {
+			aligned = aligned || tagMinors[function][minor]
+		}
+		if !aligned {
+			audit.MisalignedFunctions = append(audit.MisalignedFunctions, function)
+		}
+	}
+	sort.Strings(audit.MisalignedFunctions)
+	return audit
+}
+
+func addMinor(minors map[string]map[string]bool, function, minor string) {
+	if minors[function] == nil {
+		minors[function] = map[string]bool{}
+	}
+	minors[function][minor] = true
+}
+
+// missingMinors returns the sorted <function>/<minor> of from that aren't in to
+func missingMinors(from, to map[string]map[string]bool) []string {
+	var missing []string
+	for function, minors := range from {
+		for minor := range minors {
+			if !to[function][minor] {
+				missing = append(missing, fmt.Sprintf("%s/%s", function, minor))
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// print the inconsistencies found
+func (ra releaseAudit) print() {
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"release branches without tags:", ra.BranchesWithoutTags},
+		{"tags without release branches:", ra.TagsWithoutBranches},
+		{"functions with no release branch minor version matching a tag:", ra.MisalignedFunctions},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		infof("%s", section.title)
+		for _, item := range section.items {
+			infof("  %s", item)
+		}
+	}
+}
+
+// audit checks every release branch has a tag and every tag a release branch
+func audit() error {
+	if err := gitFetch(); err != nil {
+		return err
+	}
+	branches, err := gitRemoteBranches()
+	if err != nil {
+		return err
+	}
+	tags, err := gitTag()
+	if err != nil {
+		return err
+	}
+	result := auditReleases(branches, strings.Split(tags, "\n"))
+	if !result.consistent() {
+		result.print()
+		return fmt.Errorf("release branches and tags are inconsistent")
+	}
+	infof("release branches and tags are consistent")
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditReleases(t *testing.T) {
+	branches := "  origin/HEAD -> origin/main\n" +
+		"  origin/main\n" +
+		"  origin/apply-setters/v0.1\n" +
+		"  origin/apply-setters/v0.2\n" +
+		"  upstream/apply-setters/v0.2\n" +
+		"  origin/set-labels/v0.2\n" +
+		"  origin/set-namespace/v0.1\n" +
+		"  origin/gatekeeper/validate/v1.0\n"
+	tags := []string{
+		"functions/go/apply-setters/v0.1.0",
+		"functions/go/apply-setters/v0.1.1",
+		"functions/go/apply-setters/v0.2.0",
+		"functions/go/set-labels/v0.1.0",
+		"functions/ts/set-namespace/v0.1.3",
+		"functions/go/ensure-name-substring/v0.1.0",
+		"functions/go/gatekeeper/validate/v1.0.0",
+		"not-a-release",
+	}
+	expected := releaseAudit{
+		BranchesWithoutTags: []string{"set-labels/v0.2"},
+		TagsWithoutBranches: []string{"ensure-name-substring/v0.1", "set-labels/v0.1"},
+		MisalignedFunctions: []string{"set-labels"},
+	}
+	actual := auditReleases(branches, tags)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+	if actual.consistent() {
+		t.Error("expected the releases to be inconsistent")
+	}
+	if !auditReleases("  origin/apply-setters/v0.1\n", tags[:2]).consistent() {
+		t.Error("expected the releases to be consistent")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// changedReleaseTags returns the latest release tags of the functions with
+// files changed since ref, including non-doc files, or with release tags since
+// ref, i.e. whose version changed
+func changedReleaseTags(latestTags []string, ref string) ([]string, error) {
+	files, err := gitChangedFiles(ref)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := gitTagsSince(ref)
+	if err != nil {
+		return nil, err
+	}
+	return filterChangedReleaseTags(latestTags, files, tags), nil
+}
+
+// filterChangedReleaseTags returns the latest release tags of the functions
+// with files under functions/<language>/<function>/ or
+// contrib/functions/<language>/<function>/ in the changed files, or with one
+// of the new tags
+func filterChangedReleaseTags(latestTags, changedFiles, newTags []string) []string {
+	released := map[string]bool{}
+	for _, tag := range newTags {
+		if candidate, ok := parseReleaseTag(tag); ok {
+			released[path.Join(candidate.Language, candidate.FunctionName)] = true
+		}
+	}
+	var changed []string
+	for _, tag := range latestTags {
+		latest, ok := parseReleaseTag(tag)
+		if !ok {
+			continue
+		}
+		function := path.Join(latest.Language, latest.FunctionName)
+		if released[function] || hasChangedFile(changedFiles, function) {
+			changed = append(changed, tag)
+		}
+	}
+	return changed
+}
+
+// hasChangedFile reports whether one of the changed files is under the
+// stable or contrib directory of the <language>/<function>
+func hasChangedFile(changedFiles []string, function string) bool {
+	for _, file := range changedFiles {
+		if strings.HasPrefix(file, "functions/"+function+"/") ||
+			strings.HasPrefix(file, "contrib/functions/"+function+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseFunctions returns the <language>/<function> of each release tag
+func releaseFunctions(tags []string) []string {
+	var functions []string
+	for _, tag := range tags {
+		if candidate, ok := parseReleaseTag(tag); ok {
+			functions = append(functions, fmt.Sprintf("%s/%s", candidate.Language, candidate.FunctionName))
+		}
+	}
+	return functions
+}
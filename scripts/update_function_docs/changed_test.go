@@ -0,0 +1,50 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterChangedReleaseTags(t *testing.T) {
+	latestTags := []string{
+		"functions/go/apply-setters/v0.2.1",
+		"functions/go/gatekeeper/validate/v1.0.0",
+		"functions/go/set-labels/v0.1.5",
+		"functions/ts/set-namespace/v0.3.0",
+		"functions/go/starlark/v0.4.0",
+	}
+	changedFiles := []string{
+		"functions/go/apply-setters/main.go",
+		"contrib/functions/go/gatekeeper/validate/README.md",
+		"functions/go/set-labels-extra/README.md",
+		"examples/starlark-simple/README.md",
+		"README.md",
+	}
+	newTags := []string{"functions/ts/set-namespace/v0.3.0", "not-a-release"}
+	expected := []string{
+		"functions/go/apply-setters/v0.2.1",
+		"functions/go/gatekeeper/validate/v1.0.0",
+		"functions/ts/set-namespace/v0.3.0",
+	}
+	actual := filterChangedReleaseTags(latestTags, changedFiles, newTags)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if functions := releaseFunctions(actual); !reflect.DeepEqual(functions,
+		[]string{"go/apply-setters", "go/gatekeeper/validate", "ts/set-namespace"}) {
+		t.Errorf("unexpected functions %v", functions)
+	}
+}
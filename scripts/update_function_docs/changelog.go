@@ -0,0 +1,65 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// changelogEntry for the commit subjects of the release, e.g.
+//
+//	## apply-setters/v1.0.1
+//
+//	- Fix setter substitution in comments
+func (fr *functionRelease) changelogEntry(subjects []string) string {
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "## %s/%s\n\n", fr.FunctionName, fr.LatestPatchVersion)
+	for _, subject := range subjects {
+		fmt.Fprintf(&entry, "- %s\n", subject)
+	}
+	entry.WriteString("\n")
+	return entry.String()
+}
+
+// writeChangelog prepends an entry of the commits to the function between the
+// previous and latest patch tags to the changelog file, and reports whether
+// there was an entry to write
+func (fr *functionRelease) writeChangelog(path string) (bool, error) {
+	if fr.previousTag == "" || fr.latestTag == "" {
+		warnf("no changelog entry, %s/%s has no previous patch tag",
+			fr.FunctionName, fr.LatestPatchVersion)
+		return false, nil
+	}
+	subjects, err := gitLogSubjects(fr.previousTag, fr.latestTag, fr.FunctionPath)
+	if err != nil {
+		return false, err
+	}
+	if len(subjects) == 0 {
+		warnf("no changelog entry, no commits to %s between %s and %s",
+			fr.FunctionPath, fr.previousTag, fr.latestTag)
+		return false, nil
+	}
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	contents := append([]byte(fr.changelogEntry(subjects)), existing...)
+	if err = os.WriteFile(path, contents, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChangelog(t *testing.T) {
+	repo := setupRepo(t)
+	runGit(t, repo, "commit", "-q", "-m", "add README")
+	runGit(t, repo, "tag", "functions/go/foo/v0.1.0")
+	writeFiles(t, repo, map[string]string{"functions/go/foo/main.go": "package main\n"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "Fix foo")
+	writeFiles(t, repo, map[string]string{"functions/go/bar/main.go": "package main\n"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "Fix bar")
+	runGit(t, repo, "tag", "functions/go/foo/v0.1.1")
+	writeFiles(t, repo, map[string]string{"CHANGELOG.md": "## foo/v0.1.0\n\n- Add foo\n"})
+
+	fr := &functionRelease{
+		FunctionName:       "foo",
+		LatestPatchVersion: "v0.1.1",
+		FunctionPath:       filepath.Join(repo, "functions", "go", "foo"),
+		latestTag:          "functions/go/foo/v0.1.1",
+		previousTag:        "functions/go/foo/v0.1.0",
+	}
+	written, err := fr.writeChangelog("CHANGELOG.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !written {
+		t.Fatalf("expected a changelog entry to be written")
+	}
+	expected := "## foo/v0.1.1\n\n- Fix foo\n\n## foo/v0.1.0\n\n- Add foo\n"
+	if actual := readFile(t, filepath.Join(repo, "CHANGELOG.md")); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	fr.previousTag = ""
+	if written, err = fr.writeChangelog("CHANGELOG.md"); err != nil || written {
+		t.Errorf("expected no entry without a previous tag, got %v, %v", written, err)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// versionReferencePattern matches any versioned reference to the function,
+// deliberately broader than the search/replace operations so that references
+// they miss are found
+func (fr *functionRelease) versionReferencePattern() string {
+	return fmt.Sprintf(`%s[:/@](unstable|v[0-9]+\.[0-9]+(\.[0-9]+)?)`, regexp.QuoteMeta(fr.FunctionName))
+}
+
+// assertNoStale returns an error if the files of the HEAD commit still
+// reference a version of the function other than the latest patch or minor
+func (fr *functionRelease) assertNoStale() error {
+	files, err := gitCommitFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	// the commit files are relative to the top of the repo
+	var pathspecs []string
+	for _, file := range files {
+		pathspecs = append(pathspecs, ":(top)"+file)
+	}
+	lines, err := gitGrep(fr.versionReferencePattern(), pathspecs...)
+	if err != nil {
+		return err
+	}
+	stale := fr.findStaleReferences(lines)
+	if len(stale) > 0 {
+		return fmt.Errorf("stale references remain after the update:\n%s", strings.Join(stale, "\n"))
+	}
+	return nil
+}
+
+// versionReference is a versioned reference to the function, e.g.
+// apply-setters:v1.0.1
+type versionReference struct {
+	Text    string
+	Version string
+}
+
+// findVersionReferences returns the versioned references to the function in
+// text
+func (fr *functionRelease) findVersionReferences(text string) []versionReference {
+	pattern := regexp.MustCompile(fr.versionReferencePattern() + `([-\w]|\.\d)?`)
+	var references []versionReference
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		// versions followed by other version characters aren't
+		// references to this release, e.g. v1.0.1-rc1
+		if match[3] != "" {
+			continue
+		}
+		references = append(references, versionReference{Text: match[0], Version: match[1]})
+	}
+	return references
+}
+
+// findStaleReferences in git grep output lines of <file>:<line>:<text>,
+// returning each stale reference as <file>:<line>: <reference>
+func (fr *functionRelease) findStaleReferences(lines string) []string {
+	var stale []string
+	for _, line := range strings.Split(lines, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, reference := range fr.findVersionReferences(parts[2]) {
+			if reference.Version == fr.LatestPatchVersion || reference.Version == fr.MinorVersion {
+				continue
+			}
+			stale = append(stale, fmt.Sprintf("%s:%s: %s", parts[0], parts[1], reference.Text))
+		}
+	}
+	return stale
+}
+
+// findStaleVersions returns the distinct versions other than the latest patch
+// or minor referenced in contents, in order
+func (fr *functionRelease) findStaleVersions(contents []byte) []string {
+	var versions []string
+	seen := map[string]bool{}
+	for _, reference := range fr.findVersionReferences(string(contents)) {
+		if reference.Version == fr.LatestPatchVersion || reference.Version == fr.MinorVersion || seen[reference.Version] {
+			continue
+		}
+		seen[reference.Version] = true
+		versions = append(versions, reference.Version)
+	}
+	return versions
+}
+
+// findConflictingReferences returns the references in contents to versions the
+// docs aren't expected to have before or after the update, which indicate the
+// doc was modified by hand. The expected versions are the latest and previous
+// patch versions of the release, the minor version and unstable.
+func (fr *functionRelease) findConflictingReferences(contents []byte) []string {
+	var conflicting []string
+	for _, reference := range fr.findVersionReferences(string(contents)) {
+		switch reference.Version {
+		case fr.LatestPatchVersion, fr.PreviousPatchVersion, fr.MinorVersion, "unstable":
+			continue
+		}
+		conflicting = append(conflicting, reference.Text)
+	}
+	return conflicting
+}
+
+// checkConsistency returns an error listing the docs of the release whose
+// references disagree on the version, see findInconsistentVersions
+func (fr *functionRelease) checkConsistency() error {
+	var inconsistent []string
+	for _, update := range fr.docUpdates {
+		contents, err := fr.readDoc(update.Path)
+		if err != nil {
+			return err
+		}
+		for _, disagreement := range fr.findInconsistentVersions(contents) {
+			inconsistent = append(inconsistent, fmt.Sprintf("%s: %s", update.Path, disagreement))
+		}
+	}
+	if len(inconsistent) > 0 {
+		return fmt.Errorf("docs reference inconsistent versions:\n%s", strings.Join(inconsistent, "\n"))
+	}
+	return nil
+}
+
+// findInconsistentVersions returns the disagreements of the references in
+// contents, which are consistent if the function references are all pinned to
+// one patch version and the catalog URLs to its minor version
+func (fr *functionRelease) findInconsistentVersions(contents []byte) []string {
+	var patches, minors []string
+	for _, reference := range fr.findVersionReferences(string(contents)) {
+		if strings.Count(reference.Version, ".") == 2 && !containsString(patches, reference.Version) {
+			patches = append(patches, reference.Version)
+		}
+	}
+	catalogPattern := regexp.MustCompile(fmt.Sprintf(`catalog\.kpt\.dev/%s/(v[0-9]+\.[0-9]+)([^.0-9]|$)`,
+		regexp.QuoteMeta(fr.FunctionName)))
+	for _, match := range catalogPattern.FindAllStringSubmatch(string(contents), -1) {
+		if !containsString(minors, match[1]) {
+			minors = append(minors, match[1])
+		}
+	}
+	var disagreements []string
+	if len(patches) > 1 {
+		disagreements = append(disagreements,
+			fmt.Sprintf("function references to patch versions %s", strings.Join(patches, ", ")))
+	}
+	if len(minors) > 1 {
+		disagreements = append(disagreements,
+			fmt.Sprintf("catalog URLs to minor versions %s", strings.Join(minors, ", ")))
+	}
+	if len(patches) == 1 && len(minors) == 1 && semver.MajorMinor(patches[0]) != minors[0] {
+		disagreements = append(disagreements,
+			fmt.Sprintf("catalog URLs to %s but function references to %s", minors[0], patches[0]))
+	}
+	return disagreements
+}
+
+// docsToUpdate returns the docs updateDocs reads and writes, the function
+// README and metadata and the example READMEs, which must exist, and the
+// example Kptfiles and JSON files and the translated READMEs that do
+func (fr *functionRelease) docsToUpdate() ([]string, error) {
+	var docs []string
+	if !fr.skipFunctionDoc() {
+		docs = append(docs,
+			filepath.Join(fr.FunctionPath, "README.md"),
+			fr.metadataPath(fr.FunctionPath))
+	}
+	if !fr.opts.SkipExamples {
+		for _, example := range fr.Examples {
+			docs = append(docs, filepath.Join(example.ExamplePath, "README.md"))
+			if exampleKptfile := filepath.Join(example.ExamplePath, "Kptfile"); fr.fileExists(exampleKptfile) {
+				docs = append(docs, exampleKptfile)
+			}
+			jsonFiles, err := fr.glob(filepath.Join(example.ExamplePath, "*.json"))
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, jsonFiles...)
+		}
+	}
+	localeDirs, err := fr.localeDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, localeDir := range localeDirs {
+		docs = append(docs, fr.translatedReadmes(localeDir)...)
+	}
+	return docs, nil
+}
+
+// checkDocs returns an error listing every doc of the release that is
+// missing, or can't be written if the docs are written, before any of them are
+// updated so a run fails without partially updating the docs
+func (fr *functionRelease) checkDocs() error {
+	docs, err := fr.docsToUpdate()
+	if err != nil {
+		return err
+	}
+	// the docs of dry runs and trees aren't written
+	checkWritable := !fr.opts.DryRun && !fr.opts.CountOnly && fr.tree == nil
+	var problems []string
+	for _, doc := range docs {
+		if !fr.fileExists(doc) {
+			problems = append(problems, fmt.Sprintf("%s: missing", doc))
+			continue
+		}
+		if !checkWritable {
+			continue
+		}
+		// opened without truncating to test the permissions
+		f, err := os.OpenFile(doc, os.O_WRONLY, 0)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: not writable", doc))
+			continue
+		}
+		f.Close()
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("docs of %s/%s can't be updated:\n%s",
+			fr.FunctionName, fr.LatestPatchVersion, strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindStaleReferences(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.1",
+	}
+	lines := "functions/go/apply-setters/README.md:3:image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+		"functions/go/apply-setters/README.md:5:https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+		"functions/go/apply-setters/README.md:7:see apply-setters/v0.1.3 and apply-setters@unstable.\n" +
+		"examples/apply-setters-simple/README.md:9:apply-setters:v0.2.1-rc1 apply-setters:v0.2.10\n"
+	expected := []string{
+		"functions/go/apply-setters/README.md:7: apply-setters/v0.1.3",
+		"functions/go/apply-setters/README.md:7: apply-setters@unstable",
+		"examples/apply-setters-simple/README.md:9: apply-setters:v0.2.10",
+	}
+	actual := fr.findStaleReferences(lines)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFindConflictingReferences(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:         "apply-setters",
+		MinorVersion:         "v0.2",
+		LatestPatchVersion:   "v0.2.2",
+		PreviousPatchVersion: "v0.2.1",
+	}
+	contents := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+		"see apply-setters/v0.2.2, apply-setters:unstable and apply-setters@v0.1.3.\n" +
+		"apply-setters:v0.2.0 apply-setters:v0.2.1-rc1\n"
+	expected := []string{"apply-setters@v0.1.3", "apply-setters:v0.2.0"}
+	actual := fr.findConflictingReferences([]byte(contents))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFindStaleVersions(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.2",
+	}
+	contents := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+		"kpt pkg get ...@apply-setters/v0.2.1 and apply-setters:unstable\n" +
+		"apply-setters:v0.2.2\n"
+	expected := []string{"v0.2.1", "unstable"}
+	actual := fr.findStaleVersions([]byte(contents))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFindInconsistentVersions(t *testing.T) {
+	fr := &functionRelease{FunctionName: "apply-setters"}
+	testCases := []struct {
+		name     string
+		contents string
+		expected []string
+	}{
+		{
+			name: "consistent",
+			contents: "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+				"kpt pkg get ...@apply-setters/v0.2.1 and apply-setters:unstable\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.2/\n",
+		},
+		{
+			name: "mixed patch versions",
+			contents: "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+				"kpt pkg get ...@apply-setters/v0.2.0\n",
+			expected: []string{"function references to patch versions v0.2.1, v0.2.0"},
+		},
+		{
+			name: "mixed catalog URLs",
+			contents: "https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.1/\n",
+			expected: []string{"catalog URLs to minor versions v0.2, v0.1"},
+		},
+		{
+			name: "catalog URL of another minor version",
+			contents: "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.1/\n",
+			expected: []string{"catalog URLs to v0.1 but function references to v0.2.1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := fr.findInconsistentVersions([]byte(tc.contents))
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckDocs(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "",
+		"examples/apply-setters-simple/README.md":  "",
+		"examples/apply-setters-simple/Kptfile":    "",
+	})
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		LatestPatchVersion: "v0.2.1",
+		FunctionPath:       filepath.Join(repoBase, "functions", "go", "apply-setters"),
+		Examples: functionExamples{
+			{ExamplePath: filepath.Join(repoBase, "examples", "apply-setters-simple"), ExampleName: "apply-setters-simple"},
+			{ExamplePath: filepath.Join(repoBase, "examples", "apply-setters-missing"), ExampleName: "apply-setters-missing"},
+		},
+	}
+	err := fr.checkDocs()
+	if err == nil {
+		t.Fatal("expected the missing docs to fail the check")
+	}
+	for _, missing := range []string{
+		filepath.Join(fr.FunctionPath, "README.md") + ": missing",
+		filepath.Join(repoBase, "examples", "apply-setters-missing", "README.md") + ": missing",
+	} {
+		if !strings.Contains(err.Error(), missing) {
+			t.Errorf("expected %q in the error, got %v", missing, err)
+		}
+	}
+
+	// only the docs in scope are checked
+	fr.opts.SkipFunctionDoc = true
+	fr.Examples = fr.Examples[:1]
+	if err = fr.checkDocs(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write read-only files")
+	}
+	kptfile := filepath.Join(repoBase, "examples", "apply-setters-simple", "Kptfile")
+	if err = os.Chmod(kptfile, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err = fr.checkDocs(); err == nil || !strings.Contains(err.Error(), kptfile+": not writable") {
+		t.Errorf("expected the read-only Kptfile to fail the check, got %v", err)
+	}
+	fr.opts.DryRun = true
+	if err = fr.checkDocs(); err != nil {
+		t.Errorf("expected the docs of a dry run not to need writing, got %v", err)
+	}
+}
+
+func TestDocsToUpdateTranslations(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/README.md":                 "",
+		"functions/go/apply-setters/metadata.yaml":             "",
+		"examples/apply-setters-simple/README.md":              "",
+		"docs/i18n/ja/functions/apply-setters/README.md":       "",
+		"docs/i18n/ja/examples/apply-setters-simple/README.md": "",
+		"docs/i18n/fr/functions/apply-setters/README.md":       "",
+	})
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, "functions", "go", "apply-setters"),
+		Examples: functionExamples{
+			{ExamplePath: filepath.Join(repoBase, "examples", "apply-setters-simple"), ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{
+			RepoDir:          repoBase,
+			TranslationsDirs: []string{"docs/i18n/ja", "docs/i18n/fr"},
+		},
+	}
+	docs, err := fr.docsToUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the locale READMEs that exist are updated, the missing fr example isn't
+	expected := []string{
+		filepath.Join(fr.FunctionPath, "README.md"),
+		filepath.Join(fr.FunctionPath, "metadata.yaml"),
+		filepath.Join(repoBase, "examples", "apply-setters-simple", "README.md"),
+		filepath.Join(repoBase, "docs", "i18n", "ja", "functions", "apply-setters", "README.md"),
+		filepath.Join(repoBase, "docs", "i18n", "ja", "examples", "apply-setters-simple", "README.md"),
+		filepath.Join(repoBase, "docs", "i18n", "fr", "functions", "apply-setters", "README.md"),
+	}
+	if !reflect.DeepEqual(expected, docs) {
+		t.Errorf("expected %v, got %v", expected, docs)
+	}
+}
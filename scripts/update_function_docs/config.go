@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// flags that are not part of the configuration
+var nonConfigFlags = map[string]bool{
+	"config":      true,
+	"dump-config": true,
+}
+
+// applyConfigFile sets the flags from a YAML file of flag names to values, e.g.
+//
+//	remote: upstream
+//	timeout: 5m
+//
+// Flags set on the command line take precedence over the config file.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err = yaml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	for name, value := range config {
+		if nonConfigFlags[name] || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in config file %s", name, path)
+		}
+		if setFlags[name] {
+			continue
+		}
+		// lists set repeatable flags once per item
+		values, isList := value.([]interface{})
+		if !isList {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			if err = fs.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("invalid %s in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stringListFlag can be repeated, e.g. -registry a -registry b
+type stringListFlag []string
+
+// String implements flag.Value
+func (sl *stringListFlag) String() string {
+	return strings.Join(*sl, ",")
+}
+
+// Set implements flag.Value
+func (sl *stringListFlag) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+// Get implements flag.Getter
+func (sl *stringListFlag) Get() interface{} {
+	return []string(*sl)
+}
+
+// isSecretFlag reports whether the value of the flag should not be printed
+func isSecretFlag(name string) bool {
+	for _, secret := range []string{"token", "secret", "password"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpConfig writes the effective configuration of the flags as YAML
+func dumpConfig(fs *flag.FlagSet, w io.Writer) error {
+	config := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if nonConfigFlags[f.Name] {
+			return
+		}
+		var value interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+		if isSecretFlag(f.Name) && f.Value.String() != "" {
+			value = "<redacted>"
+		}
+		config[f.Name] = value
+	})
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
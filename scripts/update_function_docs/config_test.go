@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Branch      string
+	Remote      string
+	Timeout     time.Duration
+	NoVerify    bool
+	GithubToken string
+}
+
+func newTestFlagSet(config *testConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&config.Branch, "branch", "", "")
+	fs.StringVar(&config.Remote, "remote", "origin", "")
+	fs.DurationVar(&config.Timeout, "timeout", 0, "")
+	fs.BoolVar(&config.NoVerify, "no-verify", false, "")
+	fs.StringVar(&config.GithubToken, "github-token", "", "")
+	fs.String("config", "", "")
+	fs.Bool("dump-config", false, "")
+	return fs
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		args     []string
+		expected testConfig
+		errorMsg string
+	}{
+		{
+			name:   "config file sets flags",
+			config: "remote: upstream\ntimeout: 5m\nno-verify: true\n",
+			expected: testConfig{
+				Remote:   "upstream",
+				Timeout:  5 * time.Minute,
+				NoVerify: true,
+			},
+		},
+		{
+			name:   "command line takes precedence",
+			config: "remote: upstream\nbranch: apply-setters/v0.1\n",
+			args:   []string{"-branch", "apply-setters/v0.2"},
+			expected: testConfig{
+				Branch: "apply-setters/v0.2",
+				Remote: "upstream",
+			},
+		},
+		{
+			name:     "unknown setting",
+			config:   "remotes: upstream\n",
+			errorMsg: `unknown setting "remotes"`,
+		},
+		{
+			name:     "invalid value",
+			config:   "timeout: soon\n",
+			errorMsg: "invalid timeout",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"config.yaml": tc.config})
+			var actual testConfig
+			fs := newTestFlagSet(&actual)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfigFile(fs, filepath.Join(dir, "config.yaml"))
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDumpConfig(t *testing.T) {
+	var config testConfig
+	fs := newTestFlagSet(&config)
+	if err := fs.Parse([]string{"-timeout", "90s", "-github-token", "abc123", "-dump-config"}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := dumpConfig(fs, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `branch: ""
+github-token: <redacted>
+no-verify: false
+remote: origin
+timeout: 1m30s
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultDiffContext is the number of context lines of the dry run diffs
+const defaultDiffContext = 3
+
+// diffOp is a line of a diff, kind is ' ' for an unchanged line, '-' for a
+// removed line or '+' for an added line
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// previewDocs prints the diffs of the docs a dry run would update
+func (fr *functionRelease) previewDocs() error {
+	for _, update := range fr.docUpdates {
+		if !update.Updated {
+			continue
+		}
+		if err := fr.previewDoc(update.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// previewDoc prints the diff of the unwritten update of a doc
+func (fr *functionRelease) previewDoc(filePath string) error {
+	updated, found := fr.unwrittenDocs[filePath]
+	if !found {
+		return nil
+	}
+	current, err := fr.readFile(filePath)
+	if err != nil {
+		return err
+	}
+	fmt.Print(unifiedDiff(filePath, current, updated, fr.opts.DiffContext))
+	return nil
+}
+
+// combinedDiff returns the diffs of the docs a dry run would update as a
+// single patch, with git diff headers of the paths relative to the repo
+func (fr *functionRelease) combinedDiff() (string, error) {
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, update := range fr.docUpdates {
+		updated, found := fr.unwrittenDocs[update.Path]
+		if !update.Updated || !found {
+			continue
+		}
+		current, err := fr.readFile(update.Path)
+		if err != nil {
+			return "", err
+		}
+		path, err := filepath.Rel(repoBase, update.Path)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(gitDiff(filepath.ToSlash(path), current, updated, fr.opts.DiffContext))
+	}
+	return out.String(), nil
+}
+
+// diffStatEntry is the number of lines inserted and deleted in a doc
+type diffStatEntry struct {
+	path       string
+	insertions int
+	deletions  int
+}
+
+// printDiffStat prints the git diff --stat of the docs updated by the
+// release, computed from the unwritten updates of a dry run
+func (fr *functionRelease) printDiffStat() error {
+	var paths []string
+	for _, update := range fr.docUpdates {
+		if update.Updated {
+			paths = append(paths, update.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if fr.unwrittenDocs == nil {
+		stat, err := gitDiffStat(paths)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(levelInfo.out, stat)
+		return nil
+	}
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return err
+	}
+	var entries []diffStatEntry
+	for _, filePath := range paths {
+		updated, found := fr.unwrittenDocs[filePath]
+		if !found {
+			continue
+		}
+		current, err := fr.readFile(filePath)
+		if err != nil {
+			return err
+		}
+		path, err := filepath.Rel(repoBase, filePath)
+		if err != nil {
+			return err
+		}
+		entry := diffStatEntry{path: filepath.ToSlash(path)}
+		for _, op := range diffLines(splitLines(current), splitLines(updated)) {
+			switch op.kind {
+			case '+':
+				entry.insertions++
+			case '-':
+				entry.deletions++
+			}
+		}
+		entries = append(entries, entry)
+	}
+	// git lists the paths in order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+	fmt.Fprint(levelInfo.out, formatDiffStat(entries))
+	return nil
+}
+
+// formatDiffStat formats the entries as git diff --stat does, without
+// scaling the graph to the terminal width
+func formatDiffStat(entries []diffStatEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	pathWidth, countWidth := 0, 0
+	insertions, deletions := 0, 0
+	for _, entry := range entries {
+		if len(entry.path) > pathWidth {
+			pathWidth = len(entry.path)
+		}
+		if width := len(fmt.Sprint(entry.insertions + entry.deletions)); width > countWidth {
+			countWidth = width
+		}
+		insertions += entry.insertions
+		deletions += entry.deletions
+	}
+	var out strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&out, " %-*s | %*d %s%s\n", pathWidth, entry.path,
+			countWidth, entry.insertions+entry.deletions,
+			strings.Repeat("+", entry.insertions), strings.Repeat("-", entry.deletions))
+	}
+	fmt.Fprintf(&out, " %d %s changed", len(entries), plural(len(entries), "file"))
+	if insertions > 0 {
+		fmt.Fprintf(&out, ", %d %s(+)", insertions, plural(insertions, "insertion"))
+	}
+	if deletions > 0 {
+		fmt.Fprintf(&out, ", %d %s(-)", deletions, plural(deletions, "deletion"))
+	}
+	out.WriteString("\n")
+	return out.String()
+}
+
+// plural of the word for n as git pluralizes its diffstat, e.g. 1 file, 2 files
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// unifiedDiff of the lines of before and after with context lines around
+// each change, or an empty string if they're equal
+func unifiedDiff(path string, before, after []byte, context int) string {
+	hunks := diffHunks(before, after, context)
+	if hunks == "" {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n", path, path) + hunks
+}
+
+// gitDiff is unifiedDiff with the headers of git diff, for the path relative
+// to the repo
+func gitDiff(path string, before, after []byte, context int) string {
+	hunks := diffHunks(before, after, context)
+	if hunks == "" {
+		return ""
+	}
+	return fmt.Sprintf("diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path) + hunks
+}
+
+// diffHunks of the lines of before and after with context lines around each
+// change
+func diffHunks(before, after []byte, context int) string {
+	ops := diffLines(splitLines(before), splitLines(after))
+	// include the changed lines and their context in hunks
+	include := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(ops) {
+				include[j] = true
+			}
+		}
+	}
+	var out strings.Builder
+	// line numbers of before and after at the current op
+	beforeLine, afterLine := 1, 1
+	for i := 0; i < len(ops); {
+		if !include[i] {
+			beforeLine, afterLine = advance(ops[i], beforeLine, afterLine)
+			i++
+			continue
+		}
+		end := i
+		for end < len(ops) && include[end] {
+			end++
+		}
+		beforeCount, afterCount := 0, 0
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				beforeCount++
+			}
+			if op.kind != '-' {
+				afterCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(beforeLine, beforeCount), hunkRange(afterLine, afterCount))
+		for _, op := range ops[i:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, strings.TrimSuffix(op.line, "\n"))
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+			beforeLine, afterLine = advance(op, beforeLine, afterLine)
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// advance the line numbers of before and after past op
+func advance(op diffOp, beforeLine, afterLine int) (int, int) {
+	if op.kind != '+' {
+		beforeLine++
+	}
+	if op.kind != '-' {
+		afterLine++
+	}
+	return beforeLine, afterLine
+}
+
+// hunkRange formats the start and count of a hunk as diff does, an empty
+// range starts at the line before it
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines of contents with their line endings, so a last line without one
+// differs from the same line with one
+func splitLines(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the ops turning a into b from their longest common
+// subsequence, removals before additions
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: '-', line: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{kind: '-', line: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{kind: '+', line: b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "1\n2\n3\n4\nfoo:v0.1.0\n6\n7\n8\n9\n10\nfoo:v0.1.0\n12\n"
+	after := "1\n2\n3\n4\nfoo:v0.1.1\n6\n7\n8\n9\n10\nfoo:v0.1.1\n12\n"
+	testCases := []struct {
+		name     string
+		before   string
+		after    string
+		context  int
+		expected string
+	}{
+		{
+			name:    "no context",
+			before:  before,
+			after:   after,
+			context: 0,
+			expected: "--- README.md\n+++ README.md\n" +
+				"@@ -5 +5 @@\n-foo:v0.1.0\n+foo:v0.1.1\n" +
+				"@@ -11 +11 @@\n-foo:v0.1.0\n+foo:v0.1.1\n",
+		},
+		{
+			name:    "separate hunks",
+			before:  before,
+			after:   after,
+			context: 1,
+			expected: "--- README.md\n+++ README.md\n" +
+				"@@ -4,3 +4,3 @@\n 4\n-foo:v0.1.0\n+foo:v0.1.1\n 6\n" +
+				"@@ -10,3 +10,3 @@\n 10\n-foo:v0.1.0\n+foo:v0.1.1\n 12\n",
+		},
+		{
+			name:    "overlapping context is merged",
+			before:  before,
+			after:   after,
+			context: 3,
+			expected: "--- README.md\n+++ README.md\n" +
+				"@@ -2,11 +2,11 @@\n 2\n 3\n 4\n-foo:v0.1.0\n+foo:v0.1.1\n 6\n 7\n 8\n 9\n 10\n-foo:v0.1.0\n+foo:v0.1.1\n 12\n",
+		},
+		{
+			name:     "added line",
+			before:   "a\n",
+			after:    "a\nb\n",
+			context:  3,
+			expected: "--- README.md\n+++ README.md\n@@ -1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			name:     "empty doc",
+			before:   "",
+			after:    "a\n",
+			context:  3,
+			expected: "--- README.md\n+++ README.md\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name:     "no newline at end of file",
+			before:   "a\nfoo:v0.1.0",
+			after:    "a\nfoo:v0.1.1",
+			context:  3,
+			expected: "--- README.md\n+++ README.md\n@@ -1,2 +1,2 @@\n a\n-foo:v0.1.0\n\\ No newline at end of file\n+foo:v0.1.1\n\\ No newline at end of file\n",
+		},
+		{
+			name:     "newline added at end of file",
+			before:   "a",
+			after:    "a\n",
+			context:  3,
+			expected: "--- README.md\n+++ README.md\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			name:     "unchanged",
+			before:   before,
+			after:    before,
+			context:  3,
+			expected: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := unifiedDiff("README.md", []byte(tc.before), []byte(tc.after), tc.context)
+			if actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFormatDiffStat(t *testing.T) {
+	entries := []diffStatEntry{
+		{path: "functions/go/foo/README.md", insertions: 2, deletions: 2},
+		{path: "examples/foo-simple/README.md", insertions: 10, deletions: 1},
+	}
+	expected := " functions/go/foo/README.md    |  4 ++--\n" +
+		" examples/foo-simple/README.md | 11 ++++++++++-\n" +
+		" 2 files changed, 12 insertions(+), 3 deletions(-)\n"
+	if actual := formatDiffStat(entries); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	expected = " README.md | 1 +\n 1 file changed, 1 insertion(+)\n"
+	if actual := formatDiffStat([]diffStatEntry{{path: "README.md", insertions: 1}}); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual := formatDiffStat(nil); actual != "" {
+		t.Errorf("expected no diffstat, got %q", actual)
+	}
+}
@@ -14,12 +14,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/mod/semver"
 	"gopkg.in/yaml.v2"
@@ -28,12 +33,74 @@ import (
 var (
 	// pattern of release branches, e.g. apply-setters/v1.0
 	releaseBranchPattern = regexp.MustCompile(`[-\w]*/(v\d*\.\d*)`)
-	// pattern of release tags, e.g. functions/go/apply-setters/v1.0.1
-	releaseTagPattern = regexp.MustCompile(`.*(go|ts)/[-\w]*/(v\d*\.\d*\.\d*)`)
+	// pattern of release tags, e.g. functions/go/apply-setters/v1.0.1, or
+	// functions/go/gatekeeper/validate/v1.0.0 for namespaced functions
+	releaseTagPattern = regexp.MustCompile(`.*(go|ts)/[-\w]*(?:/[-\w]+)*/(v\d*\.\d*\.\d*)`)
+	// registries of the function images
+	defaultRegistries = []string{"gcr.io/kpt-fn", "gcr.io/kpt-fn-contrib"}
+	// host and org of the upstream example packages
+	upstreamPackageHost = "github.com/GoogleContainerTools"
+	// markdown table rows, e.g. | apply-setters | v1.0.1 |
+	tableRowPattern = regexp.MustCompile(`(?m)^[ \t]*\|.*\|[ \t]*$`)
+	// table cells of a patch version, optionally in backticks
+	tableVersionCellPattern = regexp.MustCompile(`^(\s*\x60?)(v\d+\.\d+\.\d+)(\x60?\s*)$`)
+	// languages of the functions, as they appear in release tags
+	languages = []string{"go", "ts"}
 	// pattern for version tags, e.g. unstable, v0.1.1, v0.1
 	versionGroup = `unstable|v\d*\.\d*\.\d*|v\d*\.\d*`
+	// pattern for version tags other than unstable, e.g. v0.1.1, v0.1
+	releasedVersionGroup = `v\d*\.\d*\.\d*|v\d*\.\d*`
 )
 
+const (
+	// select the latest tag by comparing semantic versions
+	selectBySemver = "semver"
+	// select the latest tag by commit date
+	selectByDate = "date"
+
+	// update docs regardless of the versions they reference
+	onConflictOverwrite = "overwrite"
+	// leave docs that reference unexpected versions untouched with a warning
+	onConflictSkip = "skip"
+	// fail if a doc references unexpected versions
+	onConflictError = "error"
+
+	// functions may have no examples
+	examplesRequiredNone = "none"
+	// every function must have examples
+	examplesRequiredAll = "all"
+	// stable functions must have examples, contrib functions may not
+	examplesRequiredStable = "stable"
+
+	// only operate on stable functions
+	tierStable = "stable"
+	// only operate on contrib functions
+	tierContrib = "contrib"
+
+	// pin the catalog URLs of the function README to the minor version
+	urlVersionMinor = "minor"
+	// pin the catalog URLs of the function README to the patch version
+	urlVersionPatch = "patch"
+)
+
+// defaultMaxFileSize of the docs updated, 5 MiB
+const defaultMaxFileSize = 5 << 20
+
+// defaultBranchPrefix of the docs update branches
+const defaultBranchPrefix = "docs/update-"
+
+var (
+	// characters and sequences git doesn't allow in branch names, see git
+	// check-ref-format
+	invalidRefPattern = regexp.MustCompile(`[\x00-\x20\x7f~^:?*\[\\]|\.\.|@\{|//`)
+	// invalidRefPattern and slashes, which are replaced in the function name
+	// and version of the docs update branch names
+	invalidBranchSuffixPattern = regexp.MustCompile(`[\x00-\x20\x7f~^:?*\[\\/]|\.\.|@\{`)
+)
+
+// utf8BOM is the UTF-8 byte order mark some editors save docs with
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
 func dirExists(path string) bool {
 	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
 		return true
@@ -48,9 +115,59 @@ func fileExists(path string) bool {
 	return false
 }
 
+// dirExists in the tree the docs are read from
+func (fr *functionRelease) dirExists(path string) bool {
+	if fr.tree != nil {
+		return fr.tree.dirExists(path)
+	}
+	return dirExists(path)
+}
+
+// fileExists in the tree the docs are read from
+func (fr *functionRelease) fileExists(path string) bool {
+	if fr.tree != nil {
+		return fr.tree.fileExists(path)
+	}
+	return fileExists(path)
+}
+
+// readFile of the tree the docs are read from
+func (fr *functionRelease) readFile(path string) ([]byte, error) {
+	if fr.tree != nil {
+		return fr.tree.readFile(path)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// fileSize in bytes in the tree the docs are read from
+func (fr *functionRelease) fileSize(path string) (int64, error) {
+	if fr.tree != nil {
+		return fr.tree.fileSize(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// glob the tree the docs are read from
+func (fr *functionRelease) glob(pattern string) ([]string, error) {
+	if fr.tree != nil {
+		return fr.tree.glob(pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
 type functionExample struct {
 	ExamplePath string
 	ExampleName string
+	// Colocated is true if the example is in the function directory's own
+	// examples/ subdir rather than the repo-wide examples
+	Colocated bool `json:",omitempty"`
+	// Version the example's package references are pinned to, if not the
+	// latest patch version
+	Version string `json:",omitempty"`
 }
 
 type functionExamples []functionExample
@@ -64,33 +181,340 @@ func (fe functionExamples) exampleNames() []string {
 	return exampleNames
 }
 
+// releaseOptions configure how a functionRelease is resolved and updated
+type releaseOptions struct {
+	// LsRemote resolves tags from the remote with git ls-remote rather than
+	// from the local tags, which avoids fetching when only the version is needed
+	LsRemote bool
+	// Remote used by LsRemote, e.g. origin
+	Remote string
+	// MinVersion is the lowest patch version the latest can be selected from,
+	// e.g. to exclude known broken patches
+	MinVersion string
+	// PreserveUnstableURLs leaves the catalog URLs of unstable untouched, e.g.
+	// in docs demonstrating the latest changes
+	PreserveUnstableURLs bool
+	// TargetVersion is the patch version the docs are updated to, which may
+	// not be tagged yet, e.g. to stage the docs of an upcoming release
+	TargetVersion string
+	// ForceLanguage overrides the language of the tags for the paths of the
+	// docs, e.g. for a function reimplemented in another language
+	ForceLanguage string
+	// SinceTag is a prior release tag of the function used as the previous
+	// patch version, to report the version transitions of the docs since it
+	SinceTag string
+	// TagsFile lists the tag names to consider, one per line, instead of
+	// querying git, for reproducible runs
+	TagsFile string
+	// SelectBy is how the latest tag is selected, semver or date. The
+	// candidates are the vX.Y.Z release tags either way, see releaseTagPattern.
+	SelectBy string
+	// AllowFileVersion falls back to the function's VERSION file, or the
+	// info.version of its Kptfile, when no matching tag is found
+	AllowFileVersion bool
+	// Registries that mirror the default registries of the function images
+	Registries []string
+	// ExampleVersionsFile is a YAML file of example names to the versions
+	// their package references are pinned to
+	ExampleVersionsFile string
+	// TranslationsDirs are the locale directories of translated docs, e.g.
+	// docs/i18n/ja, relative to the repo unless absolute
+	TranslationsDirs []string
+	// TransformerDir is a directory of custom search/replace operations run
+	// after the built-in ones, see readTransformers
+	TransformerDir string
+	// RequireSignedTags only considers tags with valid signatures, verified
+	// with git tag -v
+	RequireSignedTags bool
+	// Placeholder is a literal version placeholder, e.g. __VERSION__, that is
+	// replaced with the latest patch version where it follows the function name
+	Placeholder string
+	// StrictTagFormat rejects the tags of the function that don't exactly
+	// match the release tag format, with a warning
+	StrictTagFormat bool
+	// SkipFunctionDoc and SkipExamples leave the function or example docs
+	// untouched
+	SkipFunctionDoc bool
+	SkipExamples    bool
+	// CountOnly counts the references without writing the docs
+	CountOnly bool
+	// DryRun reports the docs that would be updated without writing them
+	DryRun bool
+	// DiffContext is the number of context lines of the DryRun diffs
+	DiffContext int
+	// CombinedDiff prints the DryRun diffs as a single patch at the end, alone
+	// on stdout
+	CombinedDiff bool
+	// RepoDir is the repo of the docs, by default the repo the tool is built in
+	RepoDir string
+	// BranchPrefix of the docs update branch, followed by the function name
+	// and the version
+	BranchPrefix string
+	// ReadTree reads the docs from the tree of the release branch rather than
+	// the working tree, keeping the updates for a commit with git plumbing
+	ReadTree bool
+	// TreeRef is the ref the tree is read from with ReadTree, by default the
+	// release branch
+	TreeRef string
+	// OnConflict is what to do with docs that reference versions other than
+	// the expected ones, overwrite, skip or error
+	OnConflict string
+	// TierRestrict is the tier, stable or contrib, the functions operated on
+	// must be in, or any tier if empty
+	TierRestrict string
+	// ExamplesRequired is which functions must have examples in their
+	// metadata, none, all or stable
+	ExamplesRequired string
+	// RewritePackageHost is <old>=<new> to redirect the host and org of the
+	// example package references, e.g.
+	// github.com/GoogleContainerTools=github.com/example for a fork
+	RewritePackageHost string
+	// AlsoPin are <function>=<version> pins of the package references of other
+	// functions, e.g. set-labels=v0.1.5, updated along with the release for
+	// examples cross-referencing each other
+	AlsoPin []string
+	// ExcludeExamples are the names of examples whose docs are left untouched
+	ExcludeExamples []string
+	// OnlyExample is the name of the only example whose docs are updated,
+	// leaving the function docs and the other examples untouched
+	OnlyExample string
+	// StripBOM removes a leading UTF-8 byte order mark from the updated docs,
+	// which are otherwise written with the BOM they were read with
+	StripBOM bool
+	// MigrateContribPaths rewrites the contrib example paths of a function
+	// promoted to stable to the stable example paths
+	MigrateContribPaths bool
+	// TableUpdate also updates the patch versions in markdown table rows
+	// with a cell of the function name
+	TableUpdate bool
+	// YAMLVersionLists are the dotted key paths of the version lists in fenced
+	// YAML blocks whose latest entry of the release is updated, e.g. versions
+	YAMLVersionLists []string
+	// FunctionReadmeURLVersion is the version the catalog URLs of the
+	// function README are pinned to, minor or patch, the example docs are
+	// always pinned to the minor version
+	FunctionReadmeURLVersion string
+	// VersionVar is the name of a shell variable, e.g. VERSION, whose patch
+	// version assignments in fenced shell blocks are updated
+	VersionVar string
+	// ExampleURLPath is the path of the examples in the package URLs, e.g.
+	// samples, by default examples or contrib/examples
+	ExampleURLPath string
+	// MetadataFilename is the filename of the function metadata, e.g.
+	// fn-meta.yaml, by default metadata.yaml or metadata.json
+	MetadataFilename string
+	// MaxFileSize in bytes of the docs read, larger docs are skipped with a
+	// warning, 0 for no limit
+	MaxFileSize int64
+}
+
+// releaseTag is a release tag of a function, e.g. functions/go/apply-setters/v1.0.1
+type releaseTag struct {
+	Tag          string
+	Language     string
+	FunctionName string
+	PatchVersion string
+}
+
 type functionRelease struct {
 	FunctionName       string
 	MinorVersion       string
 	Language           string
 	LatestPatchVersion string
-	FunctionPath       string
-	Examples           functionExamples
-	IsContrib          bool
+	// PreviousPatchVersion is the patch version released before the latest,
+	// empty for the first patch version of a release
+	PreviousPatchVersion string
+	FunctionPath         string
+	Examples             functionExamples
+	IsContrib            bool
+
+	opts releaseOptions
+	// tree the docs are read from if ReadTree is set
+	tree *gitTree
+	// branchPath is the release branch before the minor version, e.g.
+	// origin/gatekeeper/validate, the namespaced function names of the tags
+	// are matched against
+	branchPath string
+	// latestTag and previousTag of the release, latestTag is empty if the
+	// version is read from the VERSION file or is an untagged target version
+	latestTag   string
+	previousTag string
+	// transformers run on each doc after the built-in search/replace operations
+	transformers []transformer
+	// docUpdates of the docs processed by the release, in order
+	docUpdates []docUpdate
+	// unwrittenDocs are the updated contents of the docs by path when the docs
+	// aren't written
+	unwrittenDocs map[string][]byte
+	// oversizedDocs are the docs skipped for exceeding MaxFileSize
+	oversizedDocs []string
+	// excludedExamples are the names of the examples left untouched
+	excludedExamples []string
+	// urlVersion is the version the catalog URLs are pinned to if not the
+	// minor version, set on the copy of the release updating the function
+	// README, see docRelease
+	urlVersion string
+	// docPath is the doc the versions are replaced in, set on the copy of the
+	// release updating it, see docRelease
+	docPath string
+	// rewrittenURLs are the catalog URLs rewritten by replaceURLs, see
+	// validateURLs
+	rewrittenURLs []string
+	// patterns of the search/replace operations depending only on fields
+	// fixed once the release is initialized, see releasePatterns
+	patterns *releasePatterns
+}
+
+// releasePatterns are the compiled patterns of replaceTags, replaceURLs and
+// replaceKptPackages, compiled once per release rather than once per doc
+type releasePatterns struct {
+	tag    *regexp.Regexp
+	url    *regexp.Regexp
+	kptPkg *regexp.Regexp
 }
 
 // newFunctionRelease allocates and initializes a functionRelease
-func newFunctionRelease(branch string) (*functionRelease, error) {
-	fr := &functionRelease{}
+func newFunctionRelease(branch string, opts releaseOptions) (*functionRelease, error) {
+	fr := &functionRelease{opts: opts}
+	if opts.ReadTree {
+		repoBase, err := fr.repoBase()
+		if err != nil {
+			return nil, err
+		}
+		treeRef := branch
+		if opts.TreeRef != "" {
+			treeRef = opts.TreeRef
+		}
+		if fr.tree, err = readGitTree(treeRef, repoBase); err != nil {
+			return nil, err
+		}
+	}
+	if tag, ok := parseReleaseTag(branch); ok {
+		// the docs of a release tag are pinned to the tag's version
+		fr.FunctionName = tag.FunctionName
+		fr.MinorVersion = semver.MajorMinor(tag.PatchVersion)
+		fr.setLanguage(tag.Language)
+		fr.LatestPatchVersion = tag.PatchVersion
+		if fr.opts.RequireSignedTags {
+			if err := gitVerifyTag(tag.Tag); err != nil {
+				return nil, fmt.Errorf("tag %s has no valid signature: %w", tag.Tag, err)
+			}
+		}
+		candidates, err := fr.releaseTags()
+		if err != nil {
+			return nil, err
+		}
+		fr.latestTag = tag.Tag
+		fr.setPreviousPatch(candidates)
+	} else {
+		if err := fr.setReleaseBranch(branch); err != nil {
+			return nil, err
+		}
+		if err := fr.readLatestPatchVersion(); err != nil {
+			return nil, err
+		}
+	}
+	if fr.opts.SinceTag != "" {
+		if err := fr.setSinceTag(fr.opts.SinceTag); err != nil {
+			return nil, err
+		}
+	}
+	if err := fr.readDocPaths(); err != nil {
+		return nil, err
+	}
+	if err := fr.checkAlsoPin(); err != nil {
+		return nil, err
+	}
+	if fr.opts.ExampleVersionsFile != "" {
+		if err := fr.readExampleVersions(fr.opts.ExampleVersionsFile); err != nil {
+			return nil, err
+		}
+	}
+	if fr.opts.TransformerDir != "" {
+		transformers, err := readTransformers(fr.opts.TransformerDir)
+		if err != nil {
+			return nil, err
+		}
+		fr.transformers = transformers
+	}
+	fr.patterns = fr.compilePatterns()
+	return fr, nil
+}
+
+// compilePatterns compiles the patterns of the function name, minor version
+// and examples of the release
+func (fr *functionRelease) compilePatterns() *releasePatterns {
+	urlVersions := versionGroup
+	if fr.opts.PreserveUnstableURLs {
+		urlVersions = releasedVersionGroup
+	}
+	var examplePaths []string
+	for _, example := range fr.Examples {
+		examplePaths = append(examplePaths, regexp.QuoteMeta(fr.exampleRepoPath(example)))
+	}
+	exampleGroup := strings.Join(examplePaths, "|")
+	hostGroup := regexp.QuoteMeta(upstreamPackageHost)
+	if oldHost, rewrittenHost, ok := parsePackageHostRewrite(fr.opts.RewritePackageHost); ok {
+		// references already rewritten by a previous update are still pinned
+		hostGroup = regexp.QuoteMeta(oldHost) + "|" + regexp.QuoteMeta(rewrittenHost)
+	}
+	return &releasePatterns{
+		tag: regexp.MustCompile(
+			fmt.Sprintf(`(tree/|catalog\.kpt\.dev/|(?:%s)/)?(%s)(:|/)(%s)`,
+				fr.registryGroup(), fr.FunctionName, versionGroup)),
+		url: regexp.MustCompile(
+			fmt.Sprintf(`(https://catalog\.kpt\.dev/%s/)(%s)`, fr.FunctionName, urlVersions)),
+		kptPkg: regexp.MustCompile(
+			fmt.Sprintf(`(https://)(%s)(/kpt-functions-catalog\.git/)(%s)(?:@%s/(?:%s))?(\s+|["'>]|$)`,
+				hostGroup, exampleGroup, fr.FunctionName, versionGroup)),
+	}
+}
+
+// compiledPatterns returns the compiled patterns of the release, compiling
+// them if the release wasn't allocated by newFunctionRelease
+func (fr *functionRelease) compiledPatterns() *releasePatterns {
+	if fr.patterns == nil {
+		fr.patterns = fr.compilePatterns()
+	}
+	return fr.patterns
+}
+
+// setReleaseBranch sets the function name and minor version of the release
+// from the release branch. The function name of a namespaced function is only
+// known once it's matched with the tags, see matchesFunction.
+func (fr *functionRelease) setReleaseBranch(branch string) error {
 	if !releaseBranchPattern.MatchString(branch) {
-		return nil, fmt.Errorf("invalid branch format")
+		return fmt.Errorf("invalid branch format")
 	}
 	segments := strings.Split(branch, "/")
 	// assume branch format: */<func_name>/<minor_version>
 	fr.MinorVersion = segments[len(segments)-1]
 	fr.FunctionName = segments[len(segments)-2]
-	if err := fr.readLatestPatchVersion(); err != nil {
-		return nil, err
+	fr.branchPath = strings.Join(segments[:len(segments)-1], "/")
+	return nil
+}
+
+// docsBranch is the branch for the docs update of the release, e.g.
+// docs/update-apply-setters-v1.0.1, with the characters of the function name
+// and version that aren't valid in branch names replaced, e.g. the slash of
+// gatekeeper/validate
+func (fr *functionRelease) docsBranch() string {
+	suffix := fmt.Sprintf("%s-%s", fr.FunctionName, fr.LatestPatchVersion)
+	return fr.opts.BranchPrefix + invalidBranchSuffixPattern.ReplaceAllString(suffix, "-")
+}
+
+// checkBranchName returns an error if git wouldn't accept the branch name
+func checkBranchName(name string) error {
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") || invalidRefPattern.MatchString(name) {
+		return fmt.Errorf("invalid branch name: %q", name)
 	}
-	if err := fr.readDocPaths(); err != nil {
-		return nil, err
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("invalid branch name: %q", name)
+		}
 	}
-	return fr, nil
+	return nil
 }
 
 // readLatestPatchVersion of the release from git tags
@@ -98,223 +522,1644 @@ func (fr *functionRelease) readLatestPatchVersion() error {
 	if fr.FunctionName == "" || fr.MinorVersion == "" {
 		return fmt.Errorf("missing function name and/or minor version")
 	}
-	tags, err := gitTag()
+	candidates, err := fr.releaseTags()
 	if err != nil {
 		return err
 	}
-	funcPattern := fmt.Sprintf("%s/%s", fr.FunctionName, fr.MinorVersion)
-	var lang, latestPatchVersion string
-	for _, tag := range strings.Split(tags, "\n") {
-		if !strings.Contains(tag, funcPattern) || !releaseTagPattern.MatchString(tag) {
-			continue
+	if fr.opts.TargetVersion != "" {
+		return fr.setTargetVersion(candidates)
+	}
+	eligible := candidates
+	if fr.opts.MinVersion != "" {
+		eligible = aboveFloor(candidates, fr.opts.MinVersion)
+		if len(candidates) > 0 && len(eligible) == 0 {
+			return fmt.Errorf("no tag of %s/%s at or above -min-version %s",
+				fr.FunctionName, fr.MinorVersion, fr.opts.MinVersion)
+		}
+	}
+	latest := fr.selectLatest(eligible)
+	if latest == nil && fr.opts.AllowFileVersion {
+		repoBase, err := fr.repoBase()
+		if err != nil {
+			return err
 		}
-		segments := strings.Split(tag, "/")
-		patchVersion := segments[len(segments)-1]
-		if latestPatchVersion == "" ||
-			semver.Compare(patchVersion, latestPatchVersion) == 1 {
-			latestPatchVersion = patchVersion
-			lang = segments[len(segments)-3]
+		if latest, err = fr.readFileVersion(repoBase); err != nil {
+			return err
 		}
 	}
-	if latestPatchVersion == "" || lang == "" {
+	if latest == nil || latest.Language == "" {
+		// the tags of a shallow clone may not have been fetched
+		if fr.opts.TagsFile == "" && !fr.opts.LsRemote && gitIsShallow() {
+			return fmt.Errorf("could not find matching tag for release branch in a shallow clone, " +
+				"fetch the tags with git fetch --unshallow --tags or rerun with -unshallow")
+		}
 		return fmt.Errorf("could not find matching tag for release branch")
 	}
-	fr.Language = lang
-	fr.LatestPatchVersion = latestPatchVersion
+	fr.setLanguage(latest.Language)
+	// the full name of a namespaced function, the VERSION file has none
+	if latest.FunctionName != "" {
+		fr.FunctionName = latest.FunctionName
+	}
+	fr.LatestPatchVersion = latest.PatchVersion
+	fr.latestTag = latest.Tag
+	fr.setPreviousPatch(candidates)
 	return nil
 }
 
-// readDocPaths and set documentation paths
-func (fr *functionRelease) readDocPaths() error {
-	executablePath, err := os.Executable()
-	if err != nil {
-		return err
+// setTargetVersion sets the latest patch version of the release to the target
+// version. If it isn't tagged yet the language is that of the other tags of the
+// release, or of the directory the function is found in.
+func (fr *functionRelease) setTargetVersion(candidates []releaseTag) error {
+	version := fr.opts.TargetVersion
+	if semver.MajorMinor(version) != fr.MinorVersion {
+		return fmt.Errorf("-target-version %s is not a patch version of %s", version, fr.MinorVersion)
 	}
-	repoBase := filepath.Dir(filepath.Dir(filepath.Dir(executablePath)))
-	pathsToTry := []struct {
-		functionPath string
-		examplesPath string
-		isContrib    bool
-	}{
-		{
-			functionPath: filepath.Join(repoBase, "functions", fr.Language, fr.FunctionName),
-			examplesPath: filepath.Join(repoBase, "examples"),
-			isContrib:    false,
-		},
-		{
-			functionPath: filepath.Join(repoBase, "contrib", "functions", fr.Language, fr.FunctionName),
-			examplesPath: filepath.Join(repoBase, "contrib", "examples"),
-			isContrib:    true,
-		},
-	}
-	var examplesPath string
-	for _, pathToTry := range pathsToTry {
-		if dirExists(pathToTry.functionPath) {
-			fr.FunctionPath = pathToTry.functionPath
-			fr.IsContrib = pathToTry.isContrib
-			examplesPath = pathToTry.examplesPath
+	target := releaseTag{PatchVersion: version}
+	for _, candidate := range candidates {
+		if candidate.PatchVersion == version {
+			target = candidate
 			break
 		}
 	}
-	if fr.FunctionPath == "" {
-		return fmt.Errorf("function doc paths not found from %+v", pathsToTry)
+	if target.Tag == "" {
+		warnf("using unverified -target-version %s, it isn't tagged for %s", version, fr.FunctionName)
+		if latest := latestBySemver(candidates); latest != nil {
+			target.Language = latest.Language
+			target.FunctionName = latest.FunctionName
+		} else if language, err := fr.findLanguage(); err != nil {
+			return err
+		} else {
+			target.Language = language
+		}
 	}
-	if err = fr.parseMetadata(examplesPath); err != nil {
-		return err
+	fr.setLanguage(target.Language)
+	if target.FunctionName != "" {
+		fr.FunctionName = target.FunctionName
 	}
+	fr.LatestPatchVersion = version
+	fr.latestTag = target.Tag
+	fr.setPreviousPatch(candidates)
 	return nil
 }
 
-// parseMetadata from metadata.yaml and set example paths
-func (fr *functionRelease) parseMetadata(examplesPath string) error {
-	type metadata struct {
-		ExamplePackageUrls []string `yaml:"examplePackageURLs"`
+// findLanguage returns the language of the directory the function is found in,
+// for releases without tags
+func (fr *functionRelease) findLanguage() (string, error) {
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return "", err
 	}
-	if fr.FunctionPath == "" {
-		return fmt.Errorf("expected FunctionPath in parseMetadata")
+	for _, language := range languages {
+		for _, paths := range docPathsToTry(repoBase, language, fr.FunctionName) {
+			if fr.dirExists(paths.functionPath) {
+				return language, nil
+			}
+		}
 	}
+	return "", fmt.Errorf("function dir of %s not found", fr.FunctionName)
+}
 
-	metadataPath := filepath.Join(fr.FunctionPath, "metadata.yaml")
-	var md metadata
-	yamlFile, err := ioutil.ReadFile(metadataPath)
+// setLanguage sets the language of the release to that of its tag, unless the
+// language is forced
+func (fr *functionRelease) setLanguage(tagLanguage string) {
+	fr.Language = tagLanguage
+	if fr.opts.ForceLanguage == "" {
+		return
+	}
+	if fr.opts.ForceLanguage != tagLanguage {
+		warnf("forcing language %s of %s, its tag is %s", fr.opts.ForceLanguage, fr.FunctionName, tagLanguage)
+	}
+	fr.Language = fr.opts.ForceLanguage
+}
+
+// parseReleaseTag returns the release tag if ref is one, e.g.
+// functions/go/apply-setters/v1.0.1
+func parseReleaseTag(ref string) (releaseTag, bool) {
+	segments := strings.Split(ref, "/")
+	if !releaseTagPattern.MatchString(ref) || len(segments) < 3 ||
+		!semver.IsValid(segments[len(segments)-1]) {
+		return releaseTag{}, false
+	}
+	// the function name is every segment between the language and the
+	// version, e.g. gatekeeper/validate of functions/go/gatekeeper/validate/v1.0.0
+	for i := len(segments) - 3; i >= 0; i-- {
+		if containsString(languages, segments[i]) {
+			return releaseTag{
+				Tag:          ref,
+				Language:     segments[i],
+				FunctionName: strings.Join(segments[i+1:len(segments)-1], "/"),
+				PatchVersion: segments[len(segments)-1],
+			}, true
+		}
+	}
+	return releaseTag{}, false
+}
+
+// latestReleaseTags returns the tag of the latest release of each function, in
+// language and function name order
+func latestReleaseTags(opts releaseOptions) ([]string, error) {
+	fr := &functionRelease{opts: opts}
+	tags, err := fr.listTags()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	candidatesByFunction := map[string][]releaseTag{}
+	var functions []string
+	for _, tag := range tags {
+		candidate, ok := parseReleaseTag(tag)
+		if !ok {
+			continue
+		}
+		function := candidate.Language + "/" + candidate.FunctionName
+		if _, found := candidatesByFunction[function]; !found {
+			functions = append(functions, function)
+		}
+		candidatesByFunction[function] = append(candidatesByFunction[function], candidate)
+	}
+	sort.Strings(functions)
+	var latestTags []string
+	for _, function := range functions {
+		if latest := fr.selectLatest(fr.signedTags(candidatesByFunction[function])); latest != nil {
+			latestTags = append(latestTags, latest.Tag)
+		}
+	}
+	return latestTags, nil
+}
 
-	err = yaml.Unmarshal(yamlFile, &md)
+// releaseTags returns the tags of each patch version of the release
+func (fr *functionRelease) releaseTags() ([]releaseTag, error) {
+	tags, err := fr.listTags()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, exampleURL := range md.ExamplePackageUrls {
-		segments := strings.Split(exampleURL, "/")
-		exampleName := segments[len(segments)-1]
-		examplePath := filepath.Join(examplesPath, exampleName)
-		if !dirExists(examplePath) {
-			return fmt.Errorf("example dir does not exist: %s", examplePath)
+	return fr.signedTags(fr.filterReleaseTags(tags)), nil
+}
+
+// signedTags returns the candidates with valid signatures if signed tags are
+// required, otherwise all the candidates. Tags must be fetched to be verified.
+func (fr *functionRelease) signedTags(candidates []releaseTag) []releaseTag {
+	if !fr.opts.RequireSignedTags {
+		return candidates
+	}
+	var signed []releaseTag
+	for _, candidate := range candidates {
+		if err := gitVerifyTag(candidate.Tag); err != nil {
+			warnf("skipping tag %s without a valid signature", candidate.Tag)
+			continue
 		}
-		fr.Examples = append(fr.Examples, functionExample{
-			ExamplePath: examplePath,
-			ExampleName: exampleName,
-		})
+		signed = append(signed, candidate)
 	}
-	return nil
+	return signed
 }
 
-// updateDocs updates all the docs for the functionRelease on the filesystem
-func (fr *functionRelease) updateDocs() error {
-	if err := fr.updateFunctionDoc(); err != nil {
-		return err
+// filterReleaseTags returns the tags of each patch version of the release. With
+// the strict tag format, tags of the function that aren't exactly
+// <prefix>/<language>/<function>/v<major>.<minor>.<patch> are rejected with a
+// warning rather than silently skipped or accepted. If the tags of several
+// functions match, e.g. validate and gatekeeper/validate, those of the longest
+// function name are returned.
+func (fr *functionRelease) filterReleaseTags(tags []string) []releaseTag {
+	funcPattern := fmt.Sprintf("%s/%s", fr.FunctionName, fr.MinorVersion)
+	strictPattern := regexp.MustCompile(fmt.Sprintf(`^(?:[-\w]+/)*(?:%s)/(?:[-\w]+/)*%s/v\d+\.\d+\.\d+$`,
+		strings.Join(languages, "|"), regexp.QuoteMeta(fr.FunctionName)))
+	var candidates []releaseTag
+	longest := 0
+	for _, tag := range tags {
+		if fr.opts.StrictTagFormat && fr.isFunctionTag(tag) && !strictPattern.MatchString(tag) {
+			warnf("rejecting malformed release tag %s, expected <prefix>/<language>/%s/v<major>.<minor>.<patch>",
+				tag, fr.FunctionName)
+			continue
+		}
+		candidate, ok := parseReleaseTag(tag)
+		if !ok || !strings.Contains(tag, funcPattern) || !fr.matchesFunction(candidate.FunctionName) {
+			continue
+		}
+		if len(candidate.FunctionName) > longest {
+			longest = len(candidate.FunctionName)
+			candidates = nil
+		} else if len(candidate.FunctionName) < longest {
+			continue
+		}
+		candidates = append(candidates, candidate)
 	}
-	if err := fr.updateExampleDocs(); err != nil {
-		return err
+	return candidates
+}
+
+// matchesFunction reports whether the function name of a tag is the function
+// of the release, or a namespaced function whose segments end the release
+// branch path, e.g. gatekeeper/validate of origin/gatekeeper/validate/v1.0
+func (fr *functionRelease) matchesFunction(name string) bool {
+	if name == fr.FunctionName {
+		return true
 	}
-	return nil
+	return strings.HasSuffix(name, "/"+fr.FunctionName) &&
+		(fr.branchPath == name || strings.HasSuffix(fr.branchPath, "/"+name))
 }
 
-// updateFunctionDoc updates the function docs for the functionRelease
-func (fr *functionRelease) updateFunctionDoc() error {
-	functionReadme := filepath.Join(fr.FunctionPath, "README.md")
-	if err := fr.updateDoc(functionReadme); err != nil {
-		return err
+// isFunctionTag reports whether the segments of the tag include the function
+// name
+func (fr *functionRelease) isFunctionTag(tag string) bool {
+	return strings.Contains("/"+tag+"/", "/"+fr.FunctionName+"/")
+}
+
+// selectLatest returns the latest of the candidate tags, or nil if there are
+// none. Tags are compared by semver unless the date selection is configured,
+// which is intended for channels that don't strictly follow semver. If any tag
+// date can't be resolved the semver comparison is used instead.
+func (fr *functionRelease) selectLatest(candidates []releaseTag) *releaseTag {
+	if fr.opts.SelectBy == selectByDate {
+		latest, err := latestByDate(candidates)
+		if err == nil {
+			return latest
+		}
+		warnf("falling back to semver selection: %v", err)
 	}
-	functionMetadata := filepath.Join(fr.FunctionPath, "metadata.yaml")
-	if err := fr.updateDoc(functionMetadata); err != nil {
-		return err
+	return latestBySemver(candidates)
+}
+
+// latestBySemver returns the candidate with the highest patch version. Ties,
+// e.g. v1.0.1 and v1.0.1+build or the same version tagged in different
+// namespaces, are broken by preferring the longer, more specific version, then
+// the lexically first tag, so the selection doesn't depend on the tag order.
+func latestBySemver(candidates []releaseTag) *releaseTag {
+	var latest *releaseTag
+	for i := range candidates {
+		if latest == nil || semverLess(*latest, candidates[i]) {
+			latest = &candidates[i]
+		}
 	}
-	return nil
+	return latest
 }
 
-// updateExampleDocs updates the example docs for the functionRelease
-func (fr *functionRelease) updateExampleDocs() error {
-	for _, example := range fr.Examples {
-		exampleReadme := filepath.Join(example.ExamplePath, "README.md")
-		if err := fr.updateDoc(exampleReadme); err != nil {
-			return err
+// semverLess reports whether tag a sorts before tag b in latestBySemver
+func semverLess(a, b releaseTag) bool {
+	if c := semver.Compare(a.PatchVersion, b.PatchVersion); c != 0 {
+		return c == -1
+	}
+	if len(a.PatchVersion) != len(b.PatchVersion) {
+		return len(a.PatchVersion) < len(b.PatchVersion)
+	}
+	return a.Tag > b.Tag
+}
+
+// previousPatch returns the candidate with the highest patch version below
+// latest, or nil if there is none
+func previousPatch(candidates []releaseTag, latest string) *releaseTag {
+	var earlier []releaseTag
+	for _, candidate := range candidates {
+		if semver.Compare(candidate.PatchVersion, latest) == -1 {
+			earlier = append(earlier, candidate)
 		}
-		exampleKptfile := filepath.Join(example.ExamplePath, "Kptfile")
-		if fileExists(exampleKptfile) {
-			if err := fr.updateDoc(exampleKptfile); err != nil {
-				return err
-			}
+	}
+	return latestBySemver(earlier)
+}
+
+// aboveFloor returns the candidates at or above the floor version
+func aboveFloor(candidates []releaseTag, floor string) []releaseTag {
+	var eligible []releaseTag
+	for _, candidate := range candidates {
+		if semver.Compare(candidate.PatchVersion, floor) >= 0 {
+			eligible = append(eligible, candidate)
 		}
 	}
+	return eligible
+}
+
+// setPreviousPatch of the release from the candidate tags
+func (fr *functionRelease) setPreviousPatch(candidates []releaseTag) {
+	if previous := previousPatch(candidates, fr.LatestPatchVersion); previous != nil {
+		fr.PreviousPatchVersion = previous.PatchVersion
+		fr.previousTag = previous.Tag
+	}
+}
+
+// setSinceTag sets the previous patch version of the release to a prior
+// release tag of the function
+func (fr *functionRelease) setSinceTag(tag string) error {
+	since, ok := parseReleaseTag(tag)
+	if !ok || since.FunctionName != fr.FunctionName || since.Language != fr.Language {
+		return fmt.Errorf("-since-tag %s is not a release tag of %s/%s", tag, fr.Language, fr.FunctionName)
+	}
+	if semver.Compare(since.PatchVersion, fr.LatestPatchVersion) != -1 {
+		return fmt.Errorf("-since-tag %s is not before the latest patch version %s", tag, fr.LatestPatchVersion)
+	}
+	fr.PreviousPatchVersion = since.PatchVersion
+	fr.previousTag = since.Tag
 	return nil
 }
 
-// Perform in place search/replace operations on a documentation file
-func (fr *functionRelease) updateDoc(filePath string) error {
-	contents, err := ioutil.ReadFile(filePath)
+// latestByDate returns the candidate with the most recent commit date
+func latestByDate(candidates []releaseTag) (*releaseTag, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	dates, err := gitTagDates()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	contents = fr.replaceTags(contents)
-	contents = fr.replaceURLs(contents)
-	contents = fr.replaceKptPackages(contents)
-	contents = fr.replaceGithubURLs(contents)
-	if err = os.WriteFile(filePath, contents, 0644); err != nil {
-		return err
+	var latest *releaseTag
+	var latestDate time.Time
+	for i := range candidates {
+		date, found := dates[candidates[i].Tag]
+		if !found {
+			return nil, fmt.Errorf("could not resolve date of tag %s", candidates[i].Tag)
+		}
+		if latest == nil || date.After(latestDate) {
+			latest = &candidates[i]
+			latestDate = date
+		}
 	}
-	return nil
+	return latest, nil
 }
 
-// replace tags with patch e.g. apply-setters:v1.0.1, apply-setters/v1.0.1
-func (fr *functionRelease) replaceTags(contents []byte) []byte {
-	tagPattern := regexp.MustCompile(
-		fmt.Sprintf(`(%s)(:|/)(%s)`, fr.FunctionName, versionGroup))
-	contents = tagPattern.ReplaceAll(contents,
-		[]byte(fmt.Sprintf(`${1}${2}%s`, fr.LatestPatchVersion)))
-	return contents
+// readFileVersion of the release from the function's VERSION file, or the
+// info.version field of its Kptfile, for checkouts without tags. Returns nil if
+// neither is found.
+func (fr *functionRelease) readFileVersion(repoBase string) (*releaseTag, error) {
+	for _, language := range languages {
+		for _, paths := range docPathsToTry(repoBase, language, fr.FunctionName) {
+			version, versionPath, err := fr.readVersionFile(paths.functionPath)
+			if err != nil {
+				return nil, err
+			}
+			if versionPath == "" {
+				continue
+			}
+			// a full vX.Y.Z, as the tags pin, without a prerelease or build
+			if semver.Canonical(version) != version || semver.Prerelease(version) != "" ||
+				semver.MajorMinor(version) != fr.MinorVersion {
+				return nil, fmt.Errorf("version %q in %s does not match release %s",
+					version, versionPath, fr.MinorVersion)
+			}
+			warnf("no matching tag found, using version %s from %s", version, versionPath)
+			return &releaseTag{
+				Language:     language,
+				PatchVersion: version,
+			}, nil
+		}
+	}
+	return nil, nil
 }
 
-// replace url with minor e.g. https://catalog.kpt.dev/apply-setters/v1.0
-func (fr *functionRelease) replaceURLs(contents []byte) []byte {
-	urlPattern := regexp.MustCompile(
-		fmt.Sprintf(`(https://catalog\.kpt\.dev/%s/)(%s)`, fr.FunctionName, versionGroup))
-	contents = urlPattern.ReplaceAll(contents,
-		[]byte(fmt.Sprintf(`${1}%s`, fr.MinorVersion)))
-	return contents
+// readVersionFile returns the version of the function's VERSION file, or of
+// its Kptfile if it has no VERSION file, and the path it was read from, which
+// is empty if neither declares a version
+func (fr *functionRelease) readVersionFile(functionPath string) (string, string, error) {
+	versionPath := filepath.Join(functionPath, "VERSION")
+	if fr.fileExists(versionPath) {
+		contents, err := fr.readFile(versionPath)
+		if err != nil {
+			return "", "", err
+		}
+		return strings.TrimSpace(string(contents)), versionPath, nil
+	}
+	kptfilePath := filepath.Join(functionPath, "Kptfile")
+	if !fr.fileExists(kptfilePath) {
+		return "", "", nil
+	}
+	contents, err := fr.readFile(kptfilePath)
+	if err != nil {
+		return "", "", err
+	}
+	var kptfile struct {
+		Info struct {
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+	}
+	if err = yaml.Unmarshal(contents, &kptfile); err != nil {
+		return "", "", fmt.Errorf("invalid %s: %w", kptfilePath, err)
+	}
+	if kptfile.Info.Version == "" {
+		return "", "", nil
+	}
+	return strings.TrimSpace(kptfile.Info.Version), kptfilePath, nil
 }
 
-// get sub-path to examples e.g. examples, contrib/examples
-func (fr *functionRelease) exampleSubPath() string {
-	exampleSubPath := "examples"
-	if fr.IsContrib {
-		exampleSubPath = "contrib/examples"
+// listTags returns the tag names to consider for the release
+func (fr *functionRelease) listTags() ([]string, error) {
+	if fr.opts.TagsFile != "" {
+		contents, err := ioutil.ReadFile(fr.opts.TagsFile)
+		if err != nil {
+			return nil, err
+		}
+		var tags []string
+		for _, line := range strings.Split(string(contents), "\n") {
+			if tag := strings.TrimSpace(line); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags, nil
 	}
-	return exampleSubPath
+	if fr.opts.LsRemote {
+		refs, err := gitLsRemoteTags(fr.opts.Remote, fmt.Sprintf("*%s*", fr.FunctionName))
+		if err != nil {
+			return nil, err
+		}
+		return parseLsRemoteTags(refs), nil
+	}
+	tags, err := gitTag()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(tags, "\n"), nil
 }
 
-// replace kpt package names for all examples, e.g.
-// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple ->
-// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1
-func (fr *functionRelease) replaceKptPackages(contents []byte) []byte {
-	exampleGroup := strings.Join(fr.Examples.exampleNames(), "|")
-	exampleSubPath := fr.exampleSubPath()
-	kptPkgPattern := regexp.MustCompile(
-		fmt.Sprintf(`(https://github\.com/GoogleContainerTools/kpt-functions-catalog\.git/%s/)(%s)(\s+)`,
-			exampleSubPath, exampleGroup))
-	contents = kptPkgPattern.ReplaceAll(contents,
-		[]byte(fmt.Sprintf(`${1}${2}@%s/%s${3}`, fr.FunctionName, fr.LatestPatchVersion)))
-	return contents
+// parseLsRemoteTags returns the tag names from git ls-remote output, e.g.
+// 1a2b3c...	refs/tags/functions/go/apply-setters/v1.0.1
+// 4d5e6f...	refs/tags/functions/go/apply-setters/v1.0.1^{}
+func parseLsRemoteTags(refs string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(refs, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/tags/") {
+			continue
+		}
+		// annotated tags are listed twice, once peeled with a ^{} suffix
+		tag := strings.TrimSuffix(strings.TrimPrefix(fields[1], "refs/tags/"), "^{}")
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
 }
 
-// replace branch name with release branch for all GitHub URLs, e.g.
-// https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/set-namespace-simple ->
+// repoBase returns the root of the repo, the RepoDir option if set, otherwise
+// assuming the executable is built in scripts/update_function_docs
+func (fr *functionRelease) repoBase() (string, error) {
+	if fr.opts.RepoDir != "" {
+		return fr.opts.RepoDir, nil
+	}
+	executablePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(filepath.Dir(filepath.Dir(executablePath))), nil
+}
+
+// docPaths are the locations of a function's docs
+type docPaths struct {
+	functionPath string
+	examplesPath string
+	isContrib    bool
+}
+
+// docPathsToTry for a function in the stable and contrib directories
+func docPathsToTry(repoBase, language, functionName string) []docPaths {
+	return []docPaths{
+		{
+			functionPath: filepath.Join(repoBase, "functions", language, functionName),
+			examplesPath: filepath.Join(repoBase, "examples"),
+			isContrib:    false,
+		},
+		{
+			functionPath: filepath.Join(repoBase, "contrib", "functions", language, functionName),
+			examplesPath: filepath.Join(repoBase, "contrib", "examples"),
+			isContrib:    true,
+		},
+	}
+}
+
+// allDocPaths returns the doc paths of every function in the repo
+func (fr *functionRelease) allDocPaths(repoBase string) ([]docPaths, error) {
+	var all []docPaths
+	for _, language := range languages {
+		for _, pattern := range docPathsToTry(repoBase, language, "*") {
+			matches, err := fr.glob(pattern.functionPath)
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range matches {
+				if !fr.dirExists(match) {
+					continue
+				}
+				paths := pattern
+				paths.functionPath = match
+				all = append(all, paths)
+			}
+		}
+	}
+	return all, nil
+}
+
+// readDocPaths and set documentation paths
+func (fr *functionRelease) readDocPaths() error {
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return err
+	}
+	pathsToTry := docPathsToTry(repoBase, fr.Language, fr.FunctionName)
+	var examplesPath string
+	for _, pathToTry := range pathsToTry {
+		if fr.dirExists(pathToTry.functionPath) {
+			fr.FunctionPath = pathToTry.functionPath
+			fr.IsContrib = pathToTry.isContrib
+			examplesPath = pathToTry.examplesPath
+			break
+		}
+	}
+	if fr.FunctionPath == "" {
+		return fmt.Errorf("function doc paths not found from %+v", pathsToTry)
+	}
+	if err = fr.checkTier(); err != nil {
+		return err
+	}
+	if err = fr.parseMetadata(examplesPath); err != nil {
+		return err
+	}
+	if err = fr.checkExamplesRequired(); err != nil {
+		return err
+	}
+	fr.excludeExamples(fr.opts.ExcludeExamples)
+	if err = fr.selectOnlyExample(fr.opts.OnlyExample); err != nil {
+		return err
+	}
+	if err = fr.checkSharedExamples(repoBase); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkTier returns an error if the function isn't in the TierRestrict tier
+func (fr *functionRelease) checkTier() error {
+	tier := tierStable
+	if fr.IsContrib {
+		tier = tierContrib
+	}
+	if fr.opts.TierRestrict != "" && fr.opts.TierRestrict != tier {
+		return fmt.Errorf("function %s is a %s function, -tier-restrict only allows %s functions",
+			fr.FunctionName, tier, fr.opts.TierRestrict)
+	}
+	return nil
+}
+
+// parseMetadata from metadata.yaml and set example paths
+func (fr *functionRelease) parseMetadata(examplesPath string) error {
+	if fr.FunctionPath == "" {
+		return fmt.Errorf("expected FunctionPath in parseMetadata")
+	}
+
+	exampleURLs, err := fr.readExampleURLs(fr.metadataPath(fr.FunctionPath))
+	if err != nil {
+		return err
+	}
+	if exampleURLs, err = fr.expandExampleGlobs(exampleURLs, examplesPath); err != nil {
+		return err
+	}
+	exampleURLsByName := map[string]string{}
+	for _, exampleURL := range exampleURLs {
+		exampleURL = examplePackagePath(exampleURL)
+		exampleName := exampleNameFromURL(exampleURL)
+		if otherURL, found := exampleURLsByName[exampleName]; found {
+			if otherURL == exampleURL {
+				continue
+			}
+			return fmt.Errorf("examples %s and %s both resolve to example dir %s, use nested example paths",
+				otherURL, exampleURL, exampleName)
+		}
+		exampleURLsByName[exampleName] = exampleURL
+		examplePath := filepath.Join(examplesPath, exampleName)
+		colocated := false
+		if !fr.dirExists(examplePath) {
+			colocatedPath := filepath.Join(fr.FunctionPath, "examples", exampleName)
+			if !fr.dirExists(colocatedPath) {
+				return fmt.Errorf("example dir does not exist: %s or %s", examplePath, colocatedPath)
+			}
+			examplePath = colocatedPath
+			colocated = true
+		}
+		if !fr.fileExists(filepath.Join(examplePath, "README.md")) {
+			return fmt.Errorf("example %s has no README.md: %s", exampleName, examplePath)
+		}
+		fr.Examples = append(fr.Examples, functionExample{
+			ExamplePath: examplePath,
+			ExampleName: exampleName,
+			Colocated:   colocated,
+		})
+	}
+	return nil
+}
+
+// expandExampleGlobs replaces the example URLs whose example name is a glob,
+// e.g. .../examples/apply-setters-*, with the URLs of the example dirs it
+// matches under examplesPath or the function's own examples, in name order
+func (fr *functionRelease) expandExampleGlobs(exampleURLs []string, examplesPath string) ([]string, error) {
+	var expanded []string
+	for _, exampleURL := range exampleURLs {
+		pattern := exampleNameFromURL(exampleURL)
+		if !strings.ContainsAny(pattern, "*?[") {
+			expanded = append(expanded, exampleURL)
+			continue
+		}
+		exampleURL = strings.TrimSuffix(examplePackagePath(exampleURL), "/")
+		var names []string
+		for _, dir := range []string{examplesPath, filepath.Join(fr.FunctionPath, "examples")} {
+			matches, err := fr.glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("invalid example glob %s: %w", exampleURL, err)
+			}
+			for _, match := range matches {
+				if name := filepath.Base(match); fr.dirExists(match) && !containsString(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			warnf("example glob %s matches no example dirs", exampleURL)
+			continue
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			expanded = append(expanded, strings.TrimSuffix(exampleURL, pattern)+name)
+		}
+	}
+	return expanded, nil
+}
+
+// checkExamplesRequired returns an error if the function has no examples but
+// the functions of its tier must have examples
+func (fr *functionRelease) checkExamplesRequired() error {
+	if len(fr.Examples) > 0 {
+		return nil
+	}
+	switch {
+	case fr.opts.ExamplesRequired == examplesRequiredAll:
+		return fmt.Errorf("function %s has no examples, examples are required", fr.FunctionName)
+	case fr.opts.ExamplesRequired == examplesRequiredStable && !fr.IsContrib:
+		return fmt.Errorf("function %s has no examples, examples are required for stable functions", fr.FunctionName)
+	}
+	return nil
+}
+
+// excludeExamples removes the named examples so their docs are left untouched
+func (fr *functionRelease) excludeExamples(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	var examples functionExamples
+	for _, example := range fr.Examples {
+		if containsString(names, example.ExampleName) {
+			fr.excludedExamples = append(fr.excludedExamples, example.ExampleName)
+			continue
+		}
+		examples = append(examples, example)
+	}
+	fr.Examples = examples
+	for _, name := range names {
+		if !containsString(fr.excludedExamples, name) {
+			warnf("-exclude-example %s is not an example of %s", name, fr.FunctionName)
+		}
+	}
+}
+
+// selectOnlyExample removes the examples other than the named one, returning
+// an error if the function has no such example
+func (fr *functionRelease) selectOnlyExample(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, example := range fr.Examples {
+		if example.ExampleName == name {
+			fr.Examples = functionExamples{example}
+			return nil
+		}
+	}
+	return fmt.Errorf("-only-example %s is not an example of %s, expected one of: %s",
+		name, fr.FunctionName, strings.Join(fr.Examples.exampleNames(), ", "))
+}
+
+// skipFunctionDoc reports whether the function docs are left untouched
+func (fr *functionRelease) skipFunctionDoc() bool {
+	return fr.opts.SkipFunctionDoc || fr.opts.OnlyExample != ""
+}
+
+// stringList decodes either a sequence of strings or a single string
+type stringList struct {
+	Values []string
+	// IsScalar is true if a single string was decoded
+	IsScalar bool
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (sl *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&sl.Values); err == nil {
+		return nil
+	}
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	sl.Values = []string{value}
+	sl.IsScalar = true
+	return nil
+}
+
+// readExampleURLs from a function's metadata.yaml
+func readExampleURLs(metadataPath string) ([]string, error) {
+	yamlFile, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseExampleURLs(metadataPath, yamlFile)
+}
+
+// readExampleURLs from a function's metadata.yaml in the tree the docs are
+// read from
+func (fr *functionRelease) readExampleURLs(metadataPath string) ([]string, error) {
+	yamlFile, err := fr.readFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseExampleURLs(metadataPath, yamlFile)
+}
+
+// parseExampleURLs from the contents of a function's metadata.yaml
+func parseExampleURLs(metadataPath string, yamlFile []byte) ([]string, error) {
+	var md functionMetadata
+	err := yaml.Unmarshal(yamlFile, &md)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", metadataPath, err)
+	}
+	if md.ExamplePackageURLs.IsScalar {
+		warnf("examplePackageURLs in %s should be a list", metadataPath)
+	}
+	return md.ExamplePackageURLs.Values, nil
+}
+
+// checkSharedExamples returns an error if an example of another function
+// resolves to the same example dir as one of the release's examples, since the
+// release could then rewrite the other function's example docs
+func (fr *functionRelease) checkSharedExamples(repoBase string) error {
+	index, err := fr.sharedExampleIndex(repoBase)
+	if err != nil {
+		return err
+	}
+	for _, shared := range index {
+		if shared.functionPath == fr.FunctionPath {
+			continue
+		}
+		for _, example := range fr.Examples {
+			if matched, _ := filepath.Match(shared.pattern, example.ExamplePath); matched {
+				return fmt.Errorf("example dir %s is shared with %s, use nested example paths",
+					example.ExamplePath, filepath.Base(shared.functionPath))
+			}
+		}
+	}
+	return nil
+}
+
+// sharedExample is the example dir of an example URL of a function's
+// metadata, a pattern since the example name may be a glob, see
+// expandExampleGlobs
+type sharedExample struct {
+	functionPath string
+	pattern      string
+}
+
+// sharedExampleIndexes caches the example dirs of every function by repo and
+// the commit of the tree the docs are read from, so checkSharedExamples reads
+// the metadata of the functions once per run rather than once per release
+var sharedExampleIndexes = map[string][]sharedExample{}
+
+// sharedExampleIndex returns the example dirs of every function, warning of
+// the metadata that can't be read since it belongs to other releases
+func (fr *functionRelease) sharedExampleIndex(repoBase string) ([]sharedExample, error) {
+	key := repoBase
+	if fr.tree != nil {
+		key += "@" + fr.tree.commit
+	}
+	if index, found := sharedExampleIndexes[key]; found {
+		return index, nil
+	}
+	functions, err := fr.allDocPaths(repoBase)
+	if err != nil {
+		return nil, err
+	}
+	var index []sharedExample
+	for _, paths := range functions {
+		metadataPath := fr.metadataPath(paths.functionPath)
+		if !fr.fileExists(metadataPath) {
+			continue
+		}
+		exampleURLs, err := fr.readExampleURLs(metadataPath)
+		if err != nil {
+			warnf("skipping %s in the check of shared examples: %v", metadataPath, err)
+			continue
+		}
+		for _, exampleURL := range exampleURLs {
+			index = append(index, sharedExample{
+				functionPath: paths.functionPath,
+				pattern:      filepath.Join(paths.examplesPath, exampleNameFromURL(exampleURL)),
+			})
+		}
+	}
+	sharedExampleIndexes[key] = index
+	return index, nil
+}
+
+// readExampleVersions from a YAML file of example names to versions, e.g.
+//
+//	apply-setters-simple: v1.0.0
+//
+// Examples that aren't in the file are pinned to the latest patch version.
+func (fr *functionRelease) readExampleVersions(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var versions map[string]string
+	if err = yaml.Unmarshal(contents, &versions); err != nil {
+		return fmt.Errorf("invalid example versions file %s: %w", path, err)
+	}
+	for name, version := range versions {
+		if !semver.IsValid(version) {
+			return fmt.Errorf("invalid version %q for example %s in %s", version, name, path)
+		}
+		found := false
+		for i := range fr.Examples {
+			if fr.Examples[i].ExampleName == name {
+				fr.Examples[i].Version = version
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown example %s in %s, expected one of %v",
+				name, path, fr.Examples.exampleNames())
+		}
+	}
+	return nil
+}
+
+// exampleVersion returns the version the example's package references are
+// pinned to
+func (fr *functionRelease) exampleVersion(exampleName string) string {
+	for _, example := range fr.Examples {
+		if example.ExampleName == exampleName && example.Version != "" {
+			return example.Version
+		}
+	}
+	return fr.LatestPatchVersion
+}
+
+// examplePackagePath returns the URL without any query or fragment, e.g.
+// https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple?ref=main ->
+// https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple
+func examplePackagePath(exampleURL string) string {
+	parsed, err := url.Parse(exampleURL)
+	if err != nil {
+		return exampleURL
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String()
+}
+
+// exampleNameFromURL returns the last path segment of an example package URL.
+// URLs always use forward slashes, so they are split with path rather than
+// filepath, which is only used for filesystem paths.
+func exampleNameFromURL(exampleURL string) string {
+	return path.Base(strings.TrimSuffix(examplePackagePath(exampleURL), "/"))
+}
+
+// updateDocs updates all the docs for the functionRelease on the filesystem
+func (fr *functionRelease) updateDocs() error {
+	if !fr.skipFunctionDoc() {
+		if err := fr.updateFunctionDoc(); err != nil {
+			return err
+		}
+	}
+	if !fr.opts.SkipExamples {
+		if err := fr.updateExampleDocs(); err != nil {
+			return err
+		}
+	}
+	if err := fr.updateTranslatedDocs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// updateFunctionDoc updates the function docs for the functionRelease
+func (fr *functionRelease) updateFunctionDoc() error {
+	functionReadme := filepath.Join(fr.FunctionPath, "README.md")
+	if err := fr.updateDoc(functionReadme); err != nil {
+		return err
+	}
+	functionMetadata := fr.metadataPath(fr.FunctionPath)
+	if err := fr.updateDoc(functionMetadata); err != nil {
+		return err
+	}
+	return nil
+}
+
+// updateExampleDocs updates the example docs for the functionRelease
+func (fr *functionRelease) updateExampleDocs() error {
+	for _, example := range fr.Examples {
+		exampleReadme := filepath.Join(example.ExamplePath, "README.md")
+		if err := fr.updateDoc(exampleReadme); err != nil {
+			return err
+		}
+		exampleKptfile := filepath.Join(example.ExamplePath, "Kptfile")
+		if fr.fileExists(exampleKptfile) {
+			if err := fr.updateDoc(exampleKptfile); err != nil {
+				return err
+			}
+		}
+		jsonFiles, err := fr.glob(filepath.Join(example.ExamplePath, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, jsonFile := range jsonFiles {
+			if err = fr.updateJSONDoc(jsonFile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateTranslatedDocs updates the translated function and example READMEs of
+// each locale directory, <locale>/functions/<function>/README.md and
+// <locale>/examples/<example>/README.md, skipping locales without them
+func (fr *functionRelease) updateTranslatedDocs() error {
+	localeDirs, err := fr.localeDirs()
+	if err != nil {
+		return err
+	}
+	for _, localeDir := range localeDirs {
+		readmes := fr.translatedReadmes(localeDir)
+		for _, readme := range readmes {
+			if err = fr.updateDoc(readme); err != nil {
+				return err
+			}
+		}
+		if len(readmes) == 0 {
+			infof("no translated docs for %s in %s", fr.FunctionName, localeDir)
+		}
+	}
+	return nil
+}
+
+// localeDirs returns the TranslationsDirs, relative ones resolved against the
+// repo
+func (fr *functionRelease) localeDirs() ([]string, error) {
+	if len(fr.opts.TranslationsDirs) == 0 {
+		return nil, nil
+	}
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return nil, err
+	}
+	var localeDirs []string
+	for _, localeDir := range fr.opts.TranslationsDirs {
+		if !filepath.IsAbs(localeDir) {
+			localeDir = filepath.Join(repoBase, localeDir)
+		}
+		localeDirs = append(localeDirs, localeDir)
+	}
+	return localeDirs, nil
+}
+
+// translatedReadmes returns the translated function and example READMEs of
+// the locale directory that exist
+func (fr *functionRelease) translatedReadmes(localeDir string) []string {
+	var readmes []string
+	if !fr.skipFunctionDoc() {
+		readmes = append(readmes, filepath.Join(localeDir, "functions", fr.FunctionName, "README.md"))
+	}
+	if !fr.opts.SkipExamples {
+		for _, example := range fr.Examples {
+			readmes = append(readmes, filepath.Join(localeDir,
+				filepath.FromSlash(fr.exampleSubPath()), example.ExampleName, "README.md"))
+		}
+	}
+	var existing []string
+	for _, readme := range readmes {
+		if fr.fileExists(readme) {
+			existing = append(existing, readme)
+		}
+	}
+	return existing
+}
+
+// initDocs inserts the version pins into the function and example READMEs,
+// then updates all the docs for the functionRelease on the filesystem
+func (fr *functionRelease) initDocs() error {
+	var readmes []string
+	if !fr.skipFunctionDoc() {
+		readmes = append(readmes, filepath.Join(fr.FunctionPath, "README.md"))
+	}
+	if !fr.opts.SkipExamples {
+		for _, example := range fr.Examples {
+			readmes = append(readmes, filepath.Join(example.ExamplePath, "README.md"))
+		}
+	}
+	for _, readme := range readmes {
+		contents, err := fr.readDoc(readme)
+		if err != nil {
+			return err
+		}
+		updated, count := fr.insertPins(contents)
+		changed := !bytes.Equal(contents, updated)
+		fr.recordDocUpdate(readme, count, changed)
+		if !changed {
+			continue
+		}
+		fr.recordChange(readme, contents, updated)
+		if err = fr.writeDoc(readme, updated); err != nil {
+			return err
+		}
+	}
+	return fr.updateDocs()
+}
+
+// previewSeries renders the function README as it would be pinned to each patch
+// version of the release, writing each to outputDir/<version>/README.md
+func (fr *functionRelease) previewSeries(outputDir string) error {
+	candidates, err := fr.releaseTags()
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(fr.FunctionPath, "README.md"))
+	if err != nil {
+		return err
+	}
+	rendered := map[string]bool{}
+	for _, candidate := range candidates {
+		if rendered[candidate.PatchVersion] {
+			continue
+		}
+		rendered[candidate.PatchVersion] = true
+		patch := *fr
+		patch.LatestPatchVersion = candidate.PatchVersion
+		versionDir := filepath.Join(outputDir, candidate.PatchVersion)
+		if err = os.MkdirAll(versionDir, 0755); err != nil {
+			return err
+		}
+		readme := filepath.Join(versionDir, "README.md")
+		updated, _ := patch.replaceVersions(contents)
+		if err = os.WriteFile(readme, updated, 0644); err != nil {
+			return err
+		}
+		infof("rendered %s", readme)
+	}
+	return nil
+}
+
+// Perform in place search/replace operations on a documentation file
+func (fr *functionRelease) updateDoc(filePath string) error {
+	if fr.skipOversizedDoc(filePath) {
+		return nil
+	}
+	contents, err := fr.readDoc(filePath)
+	if err != nil {
+		return err
+	}
+	if skip, err := fr.skipConflictingDoc(filePath, contents); skip || err != nil {
+		return err
+	}
+	// the BOM is set aside so the replacements and transformers see the text
+	// only, and put back so the docs don't gain or lose it between runs
+	body, hasBOM := splitBOM(contents)
+	doc := fr.docRelease(filePath)
+	updated, count := doc.replaceVersions(body)
+	fr.recordRewrittenURLs(doc.rewrittenURLs)
+	if updated, err = fr.runTransformers(filePath, updated); err != nil {
+		return err
+	}
+	if hasBOM && !fr.opts.StripBOM {
+		updated = append(append([]byte{}, utf8BOM...), updated...)
+	}
+	changed := !bytes.Equal(contents, updated)
+	fr.recordDocUpdate(filePath, count, changed)
+	if !changed {
+		// leave current docs untouched so git doesn't consider them modified
+		return nil
+	}
+	fr.recordChange(filePath, contents, updated)
+	if err = fr.writeDoc(filePath, updated); err != nil {
+		return err
+	}
+	return nil
+}
+
+// skipOversizedDoc reports whether the doc exceeds MaxFileSize, guarding
+// against loading a large generated file into memory
+func (fr *functionRelease) skipOversizedDoc(filePath string) bool {
+	size, err := fr.fileSize(filePath)
+	if err != nil || fr.opts.MaxFileSize <= 0 || size <= fr.opts.MaxFileSize {
+		return false
+	}
+	warnf("skipping %s, %d bytes exceeds -max-file-size %d", filePath, size, fr.opts.MaxFileSize)
+	fr.oversizedDocs = append(fr.oversizedDocs, filePath)
+	return true
+}
+
+// skipConflictingDoc reports whether the doc is skipped for referencing
+// unexpected versions with OnConflict skip, or returns an error with
+// OnConflict error
+func (fr *functionRelease) skipConflictingDoc(filePath string, contents []byte) (bool, error) {
+	if fr.opts.OnConflict != onConflictSkip && fr.opts.OnConflict != onConflictError {
+		return false, nil
+	}
+	conflicting := fr.findConflictingReferences(contents)
+	if len(conflicting) == 0 {
+		return false, nil
+	}
+	msg := fmt.Sprintf("%s references unexpected versions, it may have been modified by hand: %s",
+		filePath, strings.Join(conflicting, ", "))
+	if fr.opts.OnConflict == onConflictError {
+		return false, fmt.Errorf("%s", msg)
+	}
+	warnf("skipping %s", msg)
+	return true, nil
+}
+
+// docRelease returns the copy of the release the versions of the doc are
+// replaced with, with the catalog URLs pinned to the patch version for the
+// function README with FunctionReadmeURLVersion patch
+func (fr *functionRelease) docRelease(filePath string) *functionRelease {
+	doc := *fr
+	doc.docPath = filePath
+	// recorded on the copy, see recordRewrittenURLs
+	doc.rewrittenURLs = nil
+	if fr.opts.FunctionReadmeURLVersion == urlVersionPatch &&
+		filePath == filepath.Join(fr.FunctionPath, "README.md") {
+		doc.urlVersion = fr.LatestPatchVersion
+	}
+	return &doc
+}
+
+// recordRewrittenURLs records the catalog URLs rewritten by replaceURLs
+func (fr *functionRelease) recordRewrittenURLs(urls []string) {
+	for _, url := range urls {
+		if !containsString(fr.rewrittenURLs, url) {
+			fr.rewrittenURLs = append(fr.rewrittenURLs, url)
+		}
+	}
+}
+
+// splitBOM returns contents without a leading UTF-8 byte order mark and
+// whether it had one
+func splitBOM(contents []byte) ([]byte, bool) {
+	if bytes.HasPrefix(contents, utf8BOM) {
+		return contents[len(utf8BOM):], true
+	}
+	return contents, false
+}
+
+// readDoc returns the contents of the doc, including updates that weren't
+// written
+func (fr *functionRelease) readDoc(filePath string) ([]byte, error) {
+	if contents, found := fr.unwrittenDocs[filePath]; found {
+		return contents, nil
+	}
+	return fr.readFile(filePath)
+}
+
+// writeDoc writes the updated contents of the doc, unless the release only
+// counts the references, is a dry run or reads the docs from a git tree, in
+// which case the contents are kept for readDoc
+func (fr *functionRelease) writeDoc(filePath string, contents []byte) error {
+	if fr.opts.CountOnly || fr.opts.DryRun || fr.tree != nil {
+		if fr.unwrittenDocs == nil {
+			fr.unwrittenDocs = map[string][]byte{}
+		}
+		fr.unwrittenDocs[filePath] = contents
+		return nil
+	}
+	return os.WriteFile(filePath, contents, 0644)
+}
+
+// replaceVersions performs all the search/replace operations on contents
+func (fr *functionRelease) replaceVersions(contents []byte) ([]byte, replaceCount) {
+	var total, count replaceCount
+	contents, count = fr.replacePlaceholders(contents)
+	total.add(count)
+	if fr.opts.MigrateContribPaths {
+		// migrated before the search/replace operations of the stable paths
+		contents, count = fr.migrateContribPaths(contents)
+		total.add(count)
+	}
+	var masked [][]byte
+	if len(fr.opts.YAMLVersionLists) > 0 {
+		// the lists are bumped first and masked, so the other passes leave
+		// the earlier entries as the version history
+		contents, count = fr.replaceYAMLVersionLists(contents)
+		total.add(count)
+		contents, masked = fr.maskYAMLVersionLists(contents)
+	}
+	contents, count = fr.replaceImages(contents)
+	total.add(count)
+	contents, count = fr.replaceTags(contents)
+	total.add(count)
+	contents, count = fr.replaceURLs(contents)
+	total.add(count)
+	contents, count = fr.replaceBadges(contents)
+	total.add(count)
+	if fr.opts.TableUpdate {
+		contents, count = fr.replaceTableRows(contents)
+		total.add(count)
+	}
+	if fr.opts.VersionVar != "" {
+		contents, count = fr.replaceVersionVar(contents)
+		total.add(count)
+	}
+	contents, count = fr.replaceKptPackages(contents)
+	total.add(count)
+	if len(fr.opts.AlsoPin) > 0 {
+		contents, count = fr.replaceAlsoPinned(contents)
+		total.add(count)
+	}
+	contents, count = fr.replaceRelativeLinks(contents)
+	total.add(count)
+	contents, count = fr.replaceGithubURLs(contents)
+	total.add(count)
+	return unmaskYAMLVersionLists(contents, masked), total
+}
+
+// replaceCount of the references matched by search/replace operations
+type replaceCount struct {
+	// Matches is the number of references found
+	Matches int
+	// Replaced is the number of references rewritten to a different value
+	Replaced int
+}
+
+func (c *replaceCount) add(other replaceCount) {
+	c.Matches += other.Matches
+	c.Replaced += other.Replaced
+}
+
+// replaceAll replaces the matches of pattern in contents with the template, as
+// regexp.ReplaceAll does, and counts the references
+func replaceAll(pattern *regexp.Regexp, contents []byte, template string) ([]byte, replaceCount) {
+	return replaceAllFunc(pattern, contents, func(match []int) ([]byte, bool) {
+		return pattern.Expand(nil, []byte(template), contents, match), true
+	})
+}
+
+// replaceAllFunc replaces the matches of pattern in contents with the return
+// value of expand, which is passed the submatch indexes of each match, and
+// counts the references. Matches that expand reports are not references are
+// left unchanged.
+func replaceAllFunc(pattern *regexp.Regexp, contents []byte,
+	expand func(match []int) ([]byte, bool)) ([]byte, replaceCount) {
+	var count replaceCount
+	var result []byte
+	last := 0
+	for _, match := range pattern.FindAllSubmatchIndex(contents, -1) {
+		replacement, ok := expand(match)
+		if !ok {
+			continue
+		}
+		count.Matches++
+		if !bytes.Equal(replacement, contents[match[0]:match[1]]) {
+			count.Replaced++
+		}
+		result = append(result, contents[last:match[0]]...)
+		result = append(result, replacement...)
+		last = match[1]
+	}
+	if count.Matches == 0 {
+		return contents, count
+	}
+	return append(result, contents[last:]...), count
+}
+
+// insert pins for unversioned references, e.g.
+// gcr.io/kpt-fn/apply-setters -> gcr.io/kpt-fn/apply-setters:v1.0.1
+// https://catalog.kpt.dev/apply-setters/ -> https://catalog.kpt.dev/apply-setters/v1.0/
+// Unversioned kpt package names are pinned by replaceKptPackages.
+func (fr *functionRelease) insertPins(contents []byte) ([]byte, replaceCount) {
+	var total, count replaceCount
+	functionName := regexp.QuoteMeta(fr.FunctionName)
+	imagePattern := regexp.MustCompile(
+		fmt.Sprintf(`((?:%s)/%s)([^-\w.:/@]|$)`, fr.registryGroup(), functionName))
+	contents, count = replaceAll(imagePattern, contents,
+		fmt.Sprintf(`${1}:%s${2}`, fr.LatestPatchVersion))
+	total.add(count)
+	urlPattern := regexp.MustCompile(
+		fmt.Sprintf(`(https://catalog\.kpt\.dev/%s)(/?)([^-\w./]|$)`, functionName))
+	contents, count = replaceAll(urlPattern, contents,
+		fmt.Sprintf(`${1}/%s${2}${3}`, fr.MinorVersion))
+	total.add(count)
+	return contents, total
+}
+
+// registryGroup returns the pattern of the function image registries
+func (fr *functionRelease) registryGroup() string {
+	var registries []string
+	seen := map[string]bool{}
+	all := append(append([]string{}, defaultRegistries...), fr.opts.Registries...)
+	for _, registry := range all {
+		registry = strings.TrimSuffix(registry, "/")
+		if !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, regexp.QuoteMeta(registry))
+		}
+	}
+	return strings.Join(registries, "|")
+}
+
+// replace the version placeholder following the function name with patch, e.g.
+// apply-setters:__VERSION__ -> apply-setters:v1.0.1
+func (fr *functionRelease) replacePlaceholders(contents []byte) ([]byte, replaceCount) {
+	if fr.opts.Placeholder == "" {
+		return contents, replaceCount{}
+	}
+	placeholderPattern := regexp.MustCompile(fmt.Sprintf(`(%s[:/@])%s`,
+		regexp.QuoteMeta(fr.FunctionName), regexp.QuoteMeta(fr.opts.Placeholder)))
+	return replaceAll(placeholderPattern, contents, fmt.Sprintf(`${1}%s`, fr.LatestPatchVersion))
+}
+
+// replace image tags in each registry with patch e.g.
+// gcr.io/kpt-fn/apply-setters:v1.0.1, us-docker.pkg.dev/kpt-fn/apply-setters:v1.0.1
+func (fr *functionRelease) replaceImages(contents []byte) ([]byte, replaceCount) {
+	imagePattern := regexp.MustCompile(
+		fmt.Sprintf(`((?:%s)/%s:)(%s)`, fr.registryGroup(), fr.FunctionName, versionGroup))
+	return replaceAll(imagePattern, contents, fmt.Sprintf(`${1}%s`, fr.LatestPatchVersion))
+}
+
+// replace tags with patch e.g. apply-setters:v1.0.1, apply-setters/v1.0.1
+func (fr *functionRelease) replaceTags(contents []byte) ([]byte, replaceCount) {
+	tagPattern := fr.compiledPatterns().tag
+	template := []byte(fmt.Sprintf(`${2}${3}%s`, fr.LatestPatchVersion))
+	return replaceAllFunc(tagPattern, contents, func(match []int) ([]byte, bool) {
+		// GitHub tree URLs and catalog URLs are pinned to the minor version by
+		// replaceGithubURLs and replaceURLs, and images by replaceImages
+		if match[2] >= 0 {
+			return nil, false
+		}
+		return tagPattern.Expand(nil, template, contents, match), true
+	})
+}
+
+// replace url with minor e.g. https://catalog.kpt.dev/apply-setters/v1.0
+func (fr *functionRelease) replaceURLs(contents []byte) ([]byte, replaceCount) {
+	version := fr.MinorVersion
+	if fr.urlVersion != "" {
+		version = fr.urlVersion
+	}
+	urlPattern := fr.compiledPatterns().url
+	template := []byte(fmt.Sprintf(`${1}%s`, version))
+	return replaceAllFunc(urlPattern, contents, func(match []int) ([]byte, bool) {
+		replacement := urlPattern.Expand(nil, template, contents, match)
+		if !bytes.Equal(replacement, contents[match[0]:match[1]]) {
+			fr.recordRewrittenURLs([]string{string(replacement)})
+		}
+		return replacement, true
+	})
+}
+
+// replace the version of shields.io static badges labelled version or with
+// the function name, which shields.io encodes with -- for a literal dash and
+// __ for a literal underscore, e.g.
+// https://img.shields.io/badge/version-v1.0.0-blue ->
+// https://img.shields.io/badge/version-v1.0.1-blue
+// https://img.shields.io/badge/apply--setters-v1.0.0-blue?style=flat ->
+// https://img.shields.io/badge/apply--setters-v1.0.1-blue?style=flat
+func (fr *functionRelease) replaceBadges(contents []byte) ([]byte, replaceCount) {
+	encodedName := strings.NewReplacer("-", "--", "_", "__").Replace(fr.FunctionName)
+	// the color follows a single dash, so versions with an encoded suffix
+	// such as v1.0.0--rc1 aren't matched
+	badgePattern := regexp.MustCompile(
+		fmt.Sprintf(`(https://img\.shields\.io/badge/(?:version|%s)-)(%s)(-[^-\s"')?]+)`,
+			regexp.QuoteMeta(encodedName), versionGroup))
+	return replaceAll(badgePattern, contents, fmt.Sprintf(`${1}%s${3}`, fr.LatestPatchVersion))
+}
+
+// migrate the contrib example paths of a function promoted to stable in the
+// package and GitHub URLs, e.g.
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/contrib/examples/apply-setters-simple ->
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple
+func (fr *functionRelease) migrateContribPaths(contents []byte) ([]byte, replaceCount) {
+	if fr.IsContrib {
+		return contents, replaceCount{}
+	}
+	var exampleNames []string
+	for _, example := range fr.Examples {
+		if !example.Colocated {
+			exampleNames = append(exampleNames, regexp.QuoteMeta(example.ExampleName))
+		}
+	}
+	if len(exampleNames) == 0 {
+		return contents, replaceCount{}
+	}
+	contribPathPattern := regexp.MustCompile(
+		fmt.Sprintf(`(kpt-functions-catalog(?:\.git|/tree/\S*?))/contrib/(examples/(?:%s))([^-\w]|$)`,
+			strings.Join(exampleNames, "|")))
+	return replaceAll(contribPathPattern, contents, `${1}/${2}${3}`)
+}
+
+// replace the patch versions of the release in markdown table rows with a cell
+// of the function name, e.g.
+// | apply-setters | v1.0.0 | ->
+// | apply-setters | v1.0.1 |
+func (fr *functionRelease) replaceTableRows(contents []byte) ([]byte, replaceCount) {
+	return replaceAllFunc(tableRowPattern, contents, func(match []int) ([]byte, bool) {
+		cells := strings.Split(string(contents[match[0]:match[1]]), "|")
+		isFunctionRow := false
+		for _, cell := range cells {
+			name := strings.Trim(strings.TrimSpace(cell), "`")
+			if name == fr.FunctionName || strings.HasPrefix(name, "["+fr.FunctionName+"]") {
+				isFunctionRow = true
+				break
+			}
+		}
+		if !isFunctionRow {
+			return nil, false
+		}
+		found := false
+		for i, cell := range cells {
+			submatch := tableVersionCellPattern.FindStringSubmatch(cell)
+			if submatch == nil || semver.MajorMinor(submatch[2]) != fr.MinorVersion {
+				continue
+			}
+			found = true
+			cells[i] = submatch[1] + fr.LatestPatchVersion + submatch[3]
+		}
+		return []byte(strings.Join(cells, "|")), found
+	})
+}
+
+// metadataPath of the function at functionPath, the MetadataFilename if set,
+// otherwise metadata.yaml, falling back to metadata.json if only it exists
+func (fr *functionRelease) metadataPath(functionPath string) string {
+	if fr.opts.MetadataFilename != "" {
+		return filepath.Join(functionPath, fr.opts.MetadataFilename)
+	}
+	metadataPath := filepath.Join(functionPath, "metadata.yaml")
+	if jsonPath := filepath.Join(functionPath, "metadata.json"); !fr.fileExists(metadataPath) && fr.fileExists(jsonPath) {
+		return jsonPath
+	}
+	return metadataPath
+}
+
+// get sub-path to examples e.g. examples, contrib/examples, or ExampleURLPath
+// if set
+func (fr *functionRelease) exampleSubPath() string {
+	if fr.opts.ExampleURLPath != "" {
+		return strings.Trim(fr.opts.ExampleURLPath, "/")
+	}
+	exampleSubPath := "examples"
+	if fr.IsContrib {
+		exampleSubPath = "contrib/examples"
+	}
+	return exampleSubPath
+}
+
+// get the repo sub-path of an example e.g. examples/apply-setters-simple,
+// functions/go/apply-setters/examples/apply-setters-simple
+func (fr *functionRelease) exampleRepoPath(example functionExample) string {
+	if !example.Colocated {
+		return fmt.Sprintf("%s/%s", fr.exampleSubPath(), example.ExampleName)
+	}
+	functionSubPath := fmt.Sprintf("functions/%s/%s", fr.Language, fr.FunctionName)
+	if fr.IsContrib {
+		functionSubPath = "contrib/" + functionSubPath
+	}
+	return fmt.Sprintf("%s/examples/%s", functionSubPath, example.ExampleName)
+}
+
+// replace kpt package names for all examples, including any existing version
+// suffix, terminated by whitespace, a quote as in HTML attributes, the
+// closing bracket of a Markdown autolink or the end of the contents, as for a
+// JSON string value, e.g.
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple ->
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0 ->
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1
+// With RewritePackageHost the host and org are redirected in the same pass.
+func (fr *functionRelease) replaceKptPackages(contents []byte) ([]byte, replaceCount) {
+	// the example group of the pattern would be empty, matching the bare repo
+	if len(fr.Examples) == 0 {
+		return contents, replaceCount{}
+	}
+	newHost := "${2}"
+	if _, rewrittenHost, ok := parsePackageHostRewrite(fr.opts.RewritePackageHost); ok {
+		newHost = rewrittenHost
+	}
+	kptPkgPattern := fr.compiledPatterns().kptPkg
+	return replaceAllFunc(kptPkgPattern, contents, func(match []int) ([]byte, bool) {
+		exampleName := path.Base(string(contents[match[8]:match[9]]))
+		template := fmt.Sprintf(`${1}%s${3}${4}@%s/%s${5}`, newHost, fr.FunctionName, fr.exampleVersion(exampleName))
+		return kptPkgPattern.Expand(nil, []byte(template), contents, match), true
+	})
+}
+
+// parsePackageHostRewrite parses <old>=<new> of -rewrite-package-host
+func parsePackageHostRewrite(rewrite string) (string, string, bool) {
+	parts := strings.SplitN(rewrite, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// parseAlsoPin parses <function>=<version> of -also-pin
+func parseAlsoPin(pin string) (string, string, bool) {
+	parts := strings.SplitN(pin, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || !semver.IsValid(parts[1]) ||
+		semver.Canonical(parts[1]) != parts[1] {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// checkAlsoPin returns an error unless every AlsoPin version of another
+// function is a release tag of it
+func (fr *functionRelease) checkAlsoPin() error {
+	for _, pin := range fr.opts.AlsoPin {
+		functionName, version, ok := parseAlsoPin(pin)
+		if !ok {
+			return fmt.Errorf("invalid -also-pin, expected <function>=<version>: %s", pin)
+		}
+		if functionName == fr.FunctionName {
+			return fmt.Errorf("-also-pin %s pins the function of the release itself", pin)
+		}
+		other := &functionRelease{FunctionName: functionName, opts: fr.opts}
+		tags, err := other.listTags()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, tag := range tags {
+			if candidate, ok := parseReleaseTag(tag); ok &&
+				candidate.FunctionName == functionName && candidate.PatchVersion == version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("-also-pin %s: no release tag of %s %s found", pin, functionName, version)
+		}
+	}
+	return nil
+}
+
+// replace the version suffix of the package references of the AlsoPin
+// functions, e.g. with set-labels=v0.1.5
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple@set-labels/v0.1.4 ->
+// https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple@set-labels/v0.1.5
+func (fr *functionRelease) replaceAlsoPinned(contents []byte) ([]byte, replaceCount) {
+	var total, count replaceCount
+	for _, pin := range fr.opts.AlsoPin {
+		functionName, version, ok := parseAlsoPin(pin)
+		if !ok {
+			continue
+		}
+		pinPattern := regexp.MustCompile(fmt.Sprintf(`(/kpt-functions-catalog\.git/[-\w./]+@%s/)(%s)\b`,
+			regexp.QuoteMeta(functionName), versionGroup))
+		contents, count = replaceAll(pinPattern, contents, "${1}"+version)
+		total.add(count)
+	}
+	return contents, total
+}
+
+// replace the version suffix of relative markdown links to examples, e.g.
+// [simple](../examples/apply-setters-simple@apply-setters/v1.0.0) ->
+// [simple](../examples/apply-setters-simple@apply-setters/v1.0.1)
+func (fr *functionRelease) replaceRelativeLinks(contents []byte) ([]byte, replaceCount) {
+	// the example group of the pattern would be empty, matching any link
+	if len(fr.Examples) == 0 {
+		return contents, replaceCount{}
+	}
+	var exampleNames []string
+	for _, name := range fr.Examples.exampleNames() {
+		exampleNames = append(exampleNames, regexp.QuoteMeta(name))
+	}
+	exampleGroup := strings.Join(exampleNames, "|")
+	linkPattern := regexp.MustCompile(
+		fmt.Sprintf(`(\]\((?:[-\w.]+/)*)(%s)@%s/(?:%s)`,
+			exampleGroup, fr.FunctionName, versionGroup))
+	return replaceAllFunc(linkPattern, contents, func(match []int) ([]byte, bool) {
+		exampleName := string(contents[match[4]:match[5]])
+		template := fmt.Sprintf(`${1}${2}@%s/%s`, fr.FunctionName, fr.exampleVersion(exampleName))
+		return linkPattern.Expand(nil, []byte(template), contents, match), true
+	})
+}
+
+// replace branch name with release branch for all GitHub URLs, e.g.
+// https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/set-namespace-simple ->
 // https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/set-namespace/v0.2/examples/set-namespace-simple
-func (fr *functionRelease) replaceGithubURLs(contents []byte) []byte {
-	exampleSubPath := fr.exampleSubPath()
+func (fr *functionRelease) replaceGithubURLs(contents []byte) ([]byte, replaceCount) {
 	suffixes := []string{
 		fmt.Sprintf(`/functions/%s/%s`, fr.Language, fr.FunctionName),
 	}
-	for _, ex := range fr.Examples.exampleNames() {
-		suffixes = append(suffixes, fmt.Sprintf(`/%s/%s`, exampleSubPath, ex))
+	for _, example := range fr.Examples {
+		suffixes = append(suffixes, "/"+fr.exampleRepoPath(example))
 	}
 	suffixGroup := strings.Join(suffixes, "|")
-	refGroup := fmt.Sprintf(`master|%s/v\d*\.\d*`, fr.FunctionName)
+	// docs updated before replaceTags skipped GitHub URLs may have the ref
+	// pinned to a patch version, so those are restored to the release branch
+	refGroup := fmt.Sprintf(`master|%s/(?:%s)`, fr.FunctionName, versionGroup)
 	githubURLPattern := regexp.MustCompile(
 		fmt.Sprintf(`(https://github\.com/GoogleContainerTools/kpt-functions-catalog/tree/)(%s)(%s)`,
 			refGroup, suffixGroup))
-	contents = githubURLPattern.ReplaceAll(contents,
-		[]byte(fmt.Sprintf(`${1}%s/%s${3}`, fr.FunctionName, fr.MinorVersion)))
-	return contents
+	return replaceAll(githubURLPattern, contents,
+		fmt.Sprintf(`${1}%s/%s${3}`, fr.FunctionName, fr.MinorVersion))
 }
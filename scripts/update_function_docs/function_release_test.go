@@ -0,0 +1,2135 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLsRemoteTags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		refs     string
+		expected []string
+	}{
+		{
+			name:     "empty output",
+			refs:     "",
+			expected: nil,
+		},
+		{
+			name: "lightweight and annotated tags",
+			refs: "1a2b3c\trefs/tags/functions/go/apply-setters/v1.0.0\n" +
+				"4d5e6f\trefs/tags/functions/go/apply-setters/v1.0.1\n" +
+				"7a8b9c\trefs/tags/functions/go/apply-setters/v1.0.1^{}\n",
+			expected: []string{
+				"functions/go/apply-setters/v1.0.0",
+				"functions/go/apply-setters/v1.0.1",
+			},
+		},
+		{
+			name: "non tag refs are ignored",
+			refs: "1a2b3c\trefs/heads/apply-setters/v1.0\n" +
+				"4d5e6f\trefs/tags/go/apply-setters/v1.0.2\n",
+			expected: []string{"go/apply-setters/v1.0.2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := parseLsRemoteTags(tc.refs)
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLatestBySemver(t *testing.T) {
+	candidates := []releaseTag{
+		{Tag: "functions/go/apply-setters/v1.0.2", Language: "go", PatchVersion: "v1.0.2"},
+		{Tag: "functions/go/apply-setters/v1.0.10", Language: "go", PatchVersion: "v1.0.10"},
+		{Tag: "functions/go/apply-setters/v1.0.9", Language: "go", PatchVersion: "v1.0.9"},
+	}
+	latest := latestBySemver(candidates)
+	if latest == nil || latest.PatchVersion != "v1.0.10" {
+		t.Errorf("expected v1.0.10, got %+v", latest)
+	}
+	if latest := latestBySemver(nil); latest != nil {
+		t.Errorf("expected no latest tag, got %+v", latest)
+	}
+}
+
+func TestLatestBySemverTiebreak(t *testing.T) {
+	candidates := []releaseTag{
+		{Tag: "go/apply-setters/v1.0.1", PatchVersion: "v1.0.1"},
+		{Tag: "functions/go/apply-setters/v1.0.1", PatchVersion: "v1.0.1"},
+		{Tag: "functions/go/apply-setters/v1.0.1+build.1", PatchVersion: "v1.0.1+build.1"},
+		{Tag: "functions/go/apply-setters/v1.0.1+build", PatchVersion: "v1.0.1+build"},
+	}
+	expected := "functions/go/apply-setters/v1.0.1+build.1"
+	// the selection is the same for every order of the candidates
+	for i := range candidates {
+		rotated := append(append([]releaseTag{}, candidates[i:]...), candidates[:i]...)
+		if latest := latestBySemver(rotated); latest == nil || latest.Tag != expected {
+			t.Errorf("expected %s, got %+v", expected, latest)
+		}
+	}
+	namespaces := candidates[:2]
+	for _, order := range [][]releaseTag{namespaces, {namespaces[1], namespaces[0]}} {
+		if latest := latestBySemver(order); latest == nil || latest.Tag != "functions/go/apply-setters/v1.0.1" {
+			t.Errorf("expected the lexically first tag, got %+v", latest)
+		}
+	}
+}
+
+func TestReadLatestPatchVersionTagsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tags.txt": "functions/go/apply-setters/v0.2.1\n" +
+			"  functions/go/apply-setters/v0.2.2  \n" +
+			"\n" +
+			"functions/go/apply-setters/v0.3.0\n" +
+			"functions/go/set-labels/v0.2.9\n",
+	})
+	// runs outside a git repo, the tags are only read from the file
+	chdir(t, dir)
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		MinorVersion: "v0.2",
+		opts:         releaseOptions{TagsFile: filepath.Join(dir, "tags.txt")},
+	}
+	if err := fr.readLatestPatchVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if fr.LatestPatchVersion != "v0.2.2" || fr.PreviousPatchVersion != "v0.2.1" {
+		t.Errorf("expected v0.2.2 after v0.2.1, got %s after %s", fr.LatestPatchVersion, fr.PreviousPatchVersion)
+	}
+}
+
+func TestReadLatestPatchVersionNamespaced(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tags.txt": "functions/go/gatekeeper/validate/v1.0.0\n" +
+			"functions/go/gatekeeper/validate/v1.0.1\n" +
+			"functions/go/gatekeeper/validate/v1.1.0\n" +
+			"functions/ts/validate/v1.0.5\n",
+	})
+	chdir(t, dir)
+	testCases := []struct {
+		name             string
+		branch           string
+		expectedFunction string
+		expectedLanguage string
+		expectedVersion  string
+	}{
+		{
+			name:             "namespaced function",
+			branch:           "origin/gatekeeper/validate/v1.0",
+			expectedFunction: "gatekeeper/validate",
+			expectedLanguage: "go",
+			expectedVersion:  "v1.0.1",
+		},
+		{
+			name:             "local namespaced branch",
+			branch:           "gatekeeper/validate/v1.1",
+			expectedFunction: "gatekeeper/validate",
+			expectedLanguage: "go",
+			expectedVersion:  "v1.1.0",
+		},
+		{
+			name:             "function of the same name outside the namespace",
+			branch:           "origin/validate/v1.0",
+			expectedFunction: "validate",
+			expectedLanguage: "ts",
+			expectedVersion:  "v1.0.5",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{opts: releaseOptions{TagsFile: filepath.Join(dir, "tags.txt")}}
+			if err := fr.setReleaseBranch(tc.branch); err != nil {
+				t.Fatal(err)
+			}
+			if err := fr.readLatestPatchVersion(); err != nil {
+				t.Fatal(err)
+			}
+			actual := []string{fr.FunctionName, fr.Language, fr.LatestPatchVersion}
+			expected := []string{tc.expectedFunction, tc.expectedLanguage, tc.expectedVersion}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestReadLatestPatchVersionForceLanguage(t *testing.T) {
+	dir := t.TempDir()
+	// the stale tags of the ts implementation sort above the go ones
+	writeFiles(t, dir, map[string]string{
+		"tags.txt": "functions/ts/apply-setters/v0.2.5\n" +
+			"functions/go/apply-setters/v0.2.1\n",
+	})
+	chdir(t, dir)
+	testCases := []struct {
+		name          string
+		forceLanguage string
+		expected      string
+	}{
+		{
+			name:     "language of the tag",
+			expected: "ts",
+		},
+		{
+			name:          "forced language",
+			forceLanguage: "go",
+			expected:      "go",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				MinorVersion: "v0.2",
+				opts: releaseOptions{
+					TagsFile:      filepath.Join(dir, "tags.txt"),
+					ForceLanguage: tc.forceLanguage,
+				},
+			}
+			if err := fr.readLatestPatchVersion(); err != nil {
+				t.Fatal(err)
+			}
+			if fr.Language != tc.expected || fr.LatestPatchVersion != "v0.2.5" {
+				t.Errorf("expected %s v0.2.5, got %s %s", tc.expected, fr.Language, fr.LatestPatchVersion)
+			}
+		})
+	}
+}
+
+func TestReadLatestPatchVersionTargetVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tags.txt":                      "functions/go/apply-setters/v0.2.1\n",
+		"no-tags.txt":                   "functions/go/apply-setters/v0.2.1\n",
+		"functions/ts/set-labels/.keep": "",
+	})
+	chdir(t, dir)
+	testCases := []struct {
+		name             string
+		tagsFile         string
+		target           string
+		expectedLanguage string
+		expectedPrevious string
+		expectedTag      string
+		errorMsg         string
+	}{
+		{
+			name:             "untagged target version",
+			tagsFile:         "tags.txt",
+			target:           "v0.2.2",
+			expectedLanguage: "go",
+			expectedPrevious: "v0.2.1",
+		},
+		{
+			name:             "tagged target version",
+			tagsFile:         "tags.txt",
+			target:           "v0.2.1",
+			expectedLanguage: "go",
+			expectedTag:      "functions/go/apply-setters/v0.2.1",
+		},
+		{
+			name:             "language of the function dir without tags",
+			tagsFile:         "no-tags.txt",
+			target:           "v0.2.0",
+			expectedLanguage: "ts",
+		},
+		{
+			name:     "target version of another minor version",
+			tagsFile: "tags.txt",
+			target:   "v0.3.0",
+			errorMsg: "-target-version v0.3.0 is not a patch version of v0.2",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			functionName := "apply-setters"
+			if tc.tagsFile == "no-tags.txt" {
+				functionName = "set-labels"
+			}
+			fr := &functionRelease{
+				FunctionName: functionName,
+				MinorVersion: "v0.2",
+				opts: releaseOptions{
+					TagsFile:      filepath.Join(dir, tc.tagsFile),
+					TargetVersion: tc.target,
+					RepoDir:       dir,
+				},
+			}
+			err := fr.readLatestPatchVersion()
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := []string{fr.Language, fr.LatestPatchVersion, fr.PreviousPatchVersion, fr.latestTag}
+			expected := []string{tc.expectedLanguage, tc.target, tc.expectedPrevious, tc.expectedTag}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestSetSinceTag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tag      string
+		expected string
+		errorMsg string
+	}{
+		{
+			name:     "prior release tag",
+			tag:      "functions/go/apply-setters/v0.1.3",
+			expected: "v0.1.3",
+		},
+		{
+			name:     "tag of another function",
+			tag:      "functions/go/set-labels/v0.1.3",
+			errorMsg: "is not a release tag of go/apply-setters",
+		},
+		{
+			name:     "tag of the latest patch version",
+			tag:      "functions/go/apply-setters/v0.2.2",
+			errorMsg: "is not before the latest patch version",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:         "apply-setters",
+				Language:             "go",
+				LatestPatchVersion:   "v0.2.2",
+				PreviousPatchVersion: "v0.2.1",
+			}
+			err := fr.setSinceTag(tc.tag)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fr.PreviousPatchVersion != tc.expected || fr.previousTag != tc.tag {
+				t.Errorf("expected %s from %s, got %s from %s", tc.expected, tc.tag, fr.PreviousPatchVersion, fr.previousTag)
+			}
+		})
+	}
+}
+
+func TestReadLatestPatchVersionMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tags.txt": "functions/go/apply-setters/v0.2.0\n" +
+			"functions/go/apply-setters/v0.2.1\n" +
+			"functions/go/apply-setters/v0.3.0\n",
+	})
+	chdir(t, dir)
+	testCases := []struct {
+		name       string
+		minVersion string
+		expected   string
+		errorMsg   string
+	}{
+		{
+			name:       "latest above the floor",
+			minVersion: "v0.2.1",
+			expected:   "v0.2.1",
+		},
+		{
+			name:       "all tags below the floor",
+			minVersion: "v0.2.2",
+			errorMsg:   "no tag of apply-setters/v0.2 at or above -min-version v0.2.2",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				MinorVersion: "v0.2",
+				opts:         releaseOptions{TagsFile: filepath.Join(dir, "tags.txt"), MinVersion: tc.minVersion},
+			}
+			err := fr.readLatestPatchVersion()
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fr.LatestPatchVersion != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, fr.LatestPatchVersion)
+			}
+		})
+	}
+}
+
+func TestFilterReleaseTags(t *testing.T) {
+	tags := []string{
+		"functions/go/apply-setters/v1.0.0",
+		"go/apply-setters/v1.0",
+		"functions/go/apply-setters/v1.0.1-rc1",
+		"functions/go/apply-setters/v1.0.2",
+		"functions/go/apply-setters-extra/v1.0.3",
+		"functions/go/set-labels/v1.0.4",
+	}
+	testCases := []struct {
+		name     string
+		strict   bool
+		expected []string
+	}{
+		{
+			name:     "lenient",
+			expected: []string{"functions/go/apply-setters/v1.0.0", "functions/go/apply-setters/v1.0.1-rc1", "functions/go/apply-setters/v1.0.2"},
+		},
+		{
+			name:     "strict",
+			strict:   true,
+			expected: []string{"functions/go/apply-setters/v1.0.0", "functions/go/apply-setters/v1.0.2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				MinorVersion: "v1.0",
+				opts:         releaseOptions{StrictTagFormat: tc.strict},
+			}
+			var actual []string
+			for _, candidate := range fr.filterReleaseTags(tags) {
+				actual = append(actual, candidate.Tag)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceGithubURLs(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "master branch",
+			input:    "https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple",
+			expected: "https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/apply-setters/v0.2/examples/apply-setters-simple",
+		},
+		{
+			name:     "ref pinned to the patch version by replaceTags",
+			input:    "https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/apply-setters/v0.2.1/functions/go/apply-setters",
+			expected: "https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/apply-setters/v0.2/functions/go/apply-setters",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tagged, _ := fr.replaceTags([]byte(tc.input))
+			updated, _ := fr.replaceGithubURLs(tagged)
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceURLs(t *testing.T) {
+	contents := "https://catalog.kpt.dev/apply-setters/unstable/\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.1/\n" +
+		"<https://catalog.kpt.dev/apply-setters/v0.1>\n"
+	testCases := []struct {
+		name             string
+		preserveUnstable bool
+		expected         string
+	}{
+		{
+			name: "unstable URL pinned",
+			expected: "https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+				"<https://catalog.kpt.dev/apply-setters/v0.2>\n",
+		},
+		{
+			name:             "unstable URL preserved",
+			preserveUnstable: true,
+			expected: "https://catalog.kpt.dev/apply-setters/unstable/\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+				"<https://catalog.kpt.dev/apply-setters/v0.2>\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				MinorVersion: "v0.2",
+				opts:         releaseOptions{PreserveUnstableURLs: tc.preserveUnstable},
+			}
+			actual, _ := fr.replaceURLs([]byte(contents))
+			if string(actual) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceKptPackages(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Language:           "go",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+			{ExampleName: "apply-setters-colocated", Colocated: true},
+		},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "bare package reference",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "package reference with a version suffix",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0 apply-setters-simple\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1 apply-setters-simple\n",
+		},
+		{
+			name:     "package reference with the latest version suffix",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "package reference in an HTML anchor",
+			input:    `<a href="https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0">simple</a>`,
+			expected: `<a href="https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1">simple</a>`,
+		},
+		{
+			name:     "package reference in a single quoted HTML attribute",
+			input:    `<a href='https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple'>simple</a>`,
+			expected: `<a href='https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1'>simple</a>`,
+		},
+		{
+			name:     "package reference in an autolink",
+			input:    "<https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0>\n",
+			expected: "<https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1>\n",
+		},
+		{
+			name:     "bare package reference in an autolink",
+			input:    "<https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple>\n",
+			expected: "<https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1>\n",
+		},
+		{
+			name:     "package reference ending the contents",
+			input:    "https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple",
+			expected: "https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1",
+		},
+		{
+			name:     "package reference to a co-located example",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/functions/go/apply-setters/examples/apply-setters-colocated@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/functions/go/apply-setters/examples/apply-setters-colocated@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "co-located example under the repo-wide examples is untouched",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-colocated\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-colocated\n",
+		},
+		{
+			name:     "other examples are untouched",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.replaceKptPackages([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceKptPackagesNoExamples(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Language:           "go",
+	}
+	input := "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/ here\n"
+	updated, count := fr.replaceKptPackages([]byte(input))
+	if string(updated) != input || count.Matches != 0 {
+		t.Errorf("expected the repo reference to be untouched, got %s with %d matches", updated, count.Matches)
+	}
+}
+
+func TestReplaceKptPackagesRewriteHost(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{RewritePackageHost: "github.com/GoogleContainerTools=gitlab.com/example"},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "upstream reference is redirected and pinned",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://gitlab.com/example/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "redirected reference is pinned",
+			input:    "$ kpt pkg get https://gitlab.com/example/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://gitlab.com/example/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "other hosts are untouched",
+			input:    "$ kpt pkg get https://github.com/other/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://github.com/other/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.replaceKptPackages([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceKptPackagesExampleURLPath(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{ExampleURLPath: "docs/samples/"},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "reference under the custom path",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/docs/samples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/docs/samples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "reference under the default path is untouched",
+			input:    "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.replaceKptPackages([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceAlsoPinned(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{AlsoPin: []string{"set-labels=v0.1.5"}},
+	}
+	input := "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple@set-labels/v0.1.4 labels\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-namespace-simple@set-namespace/v0.1.4\n"
+	expected := "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-labels-simple@set-labels/v0.1.5 labels\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/set-namespace-simple@set-namespace/v0.1.4\n"
+	updated, count := fr.replaceVersions([]byte(input))
+	if actual := string(updated); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if count.Replaced != 2 {
+		t.Errorf("expected 2 references replaced, got %+v", count)
+	}
+}
+
+func TestCheckAlsoPin(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tags.txt": "functions/go/apply-setters/v1.0.1\n" +
+			"functions/go/set-labels/v0.1.5\n",
+	})
+	chdir(t, dir)
+	testCases := []struct {
+		pin      string
+		errorMsg string
+	}{
+		{pin: "set-labels=v0.1.5"},
+		{pin: "set-labels=v0.1.6", errorMsg: "no release tag of set-labels v0.1.6 found"},
+		{pin: "set-namespace=v0.1.5", errorMsg: "no release tag of set-namespace v0.1.5 found"},
+		{pin: "apply-setters=v1.0.1", errorMsg: "pins the function of the release itself"},
+		{pin: "set-labels=latest", errorMsg: "invalid -also-pin"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pin, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				opts: releaseOptions{
+					TagsFile: filepath.Join(dir, "tags.txt"),
+					AlsoPin:  []string{tc.pin},
+				},
+			}
+			err := fr.checkAlsoPin()
+			if tc.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tc.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestMigrateContribPaths(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Language:           "go",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{MigrateContribPaths: true},
+	}
+	input := "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/contrib/examples/apply-setters-simple@apply-setters/v1.0.0\n" +
+		"[simple](https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/contrib/examples/apply-setters-simple)\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/contrib/examples/apply-setters-simple-v2\n"
+	expected := "$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n" +
+		"[simple](https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/apply-setters/v1.0/examples/apply-setters-simple)\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/contrib/examples/apply-setters-simple-v2\n"
+	updated, _ := fr.replaceVersions([]byte(input))
+	if actual := string(updated); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	// contrib functions keep their paths
+	fr.IsContrib = true
+	if updated, count := fr.migrateContribPaths([]byte(input)); string(updated) != input || count.Matches != 0 {
+		t.Errorf("expected the contrib paths of a contrib function untouched, got %s", updated)
+	}
+}
+
+func TestReplaceTableRows(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+	}
+	input := "| Function | Version | kpt |\n" +
+		"| --- | --- | --- |\n" +
+		"| apply-setters | v1.0.0 | v1.0.0 |\n" +
+		"|`apply-setters`|`v1.0.0`|\n" +
+		"| [apply-setters](https://catalog.kpt.dev/apply-setters/v1.0/) | v1.0.0 |\n" +
+		"| apply-setters | v0.2.3 |\n" +
+		"| set-labels | v1.0.0 |\n" +
+		"apply-setters v1.0.0 outside a table\n"
+	expected := "| Function | Version | kpt |\n" +
+		"| --- | --- | --- |\n" +
+		"| apply-setters | v1.0.1 | v1.0.1 |\n" +
+		"|`apply-setters`|`v1.0.1`|\n" +
+		"| [apply-setters](https://catalog.kpt.dev/apply-setters/v1.0/) | v1.0.1 |\n" +
+		"| apply-setters | v0.2.3 |\n" +
+		"| set-labels | v1.0.0 |\n" +
+		"apply-setters v1.0.0 outside a table\n"
+	updated, count := fr.replaceTableRows([]byte(input))
+	if actual := string(updated); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expectedCount := (replaceCount{Matches: 3, Replaced: 3}); count != expectedCount {
+		t.Errorf("expected %+v, got %+v", expectedCount, count)
+	}
+}
+
+func TestReplaceBadges(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "version badge",
+			input:    "![version](https://img.shields.io/badge/version-v1.0.0-blue)\n",
+			expected: "![version](https://img.shields.io/badge/version-v1.0.1-blue)\n",
+		},
+		{
+			name:     "badge labelled with the encoded function name and a query",
+			input:    "![apply-setters](https://img.shields.io/badge/apply--setters-v1.0.0-brightgreen?style=flat-square)\n",
+			expected: "![apply-setters](https://img.shields.io/badge/apply--setters-v1.0.1-brightgreen?style=flat-square)\n",
+		},
+		{
+			name:     "badge in an HTML image",
+			input:    `<img src="https://img.shields.io/badge/version-unstable-orange">`,
+			expected: `<img src="https://img.shields.io/badge/version-v1.0.1-orange">`,
+		},
+		{
+			name:     "pre-release badge is untouched",
+			input:    "![version](https://img.shields.io/badge/version-v1.0.0--rc1-blue)\n",
+			expected: "![version](https://img.shields.io/badge/version-v1.0.0--rc1-blue)\n",
+		},
+		{
+			name:     "badge of another function is untouched",
+			input:    "![set-labels](https://img.shields.io/badge/set--labels-v0.1.0-blue)\n",
+			expected: "![set-labels](https://img.shields.io/badge/set--labels-v0.1.0-blue)\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.replaceBadges([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceRelativeLinks(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "relative link with a version suffix",
+			input:    "See [simple](../examples/apply-setters-simple@apply-setters/v1.0.0).\n",
+			expected: "See [simple](../examples/apply-setters-simple@apply-setters/v1.0.1).\n",
+		},
+		{
+			name:     "relative link without a directory",
+			input:    "[simple](apply-setters-simple@apply-setters/v1.0.0)\n",
+			expected: "[simple](apply-setters-simple@apply-setters/v1.0.1)\n",
+		},
+		{
+			name: "absolute link is updated by the other passes",
+			input: "[simple](../examples/apply-setters-simple@apply-setters/v1.0.0)\n" +
+				"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n",
+			expected: "[simple](../examples/apply-setters-simple@apply-setters/v1.0.1)\n" +
+				"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "links to other examples are untouched",
+			input:    "[simple](../examples/set-labels-simple@set-labels/v1.0.0)\n",
+			expected: "[simple](../examples/set-labels-simple@set-labels/v1.0.0)\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.replaceVersions([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceRelativeLinksExampleNames(t *testing.T) {
+	testCases := []struct {
+		name     string
+		examples functionExamples
+		input    string
+	}{
+		{
+			name:  "no examples",
+			input: "[release](@apply-setters/v1.0.0)\n",
+		},
+		{
+			name:     "example name is matched literally",
+			examples: functionExamples{{ExampleName: "apply-setters.simple"}},
+			input:    "[simple](../examples/apply-setters-simple@apply-setters/v1.0.0)\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v1.0",
+				LatestPatchVersion: "v1.0.1",
+				Examples:           tc.examples,
+			}
+			updated, count := fr.replaceRelativeLinks([]byte(tc.input))
+			if string(updated) != tc.input || count.Matches != 0 {
+				t.Errorf("expected the link to be untouched, got %s with %d matches", updated, count.Matches)
+			}
+		})
+	}
+}
+
+func TestReadFileVersion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected *releaseTag
+		errorMsg string
+	}{
+		{
+			name:     "no VERSION file",
+			files:    map[string]string{"functions/go/apply-setters/README.md": ""},
+			expected: nil,
+		},
+		{
+			name:     "stable function",
+			files:    map[string]string{"functions/go/apply-setters/VERSION": "v1.0.2\n"},
+			expected: &releaseTag{Language: "go", PatchVersion: "v1.0.2"},
+		},
+		{
+			name:     "contrib function",
+			files:    map[string]string{"contrib/functions/ts/apply-setters/VERSION": "v1.0.0"},
+			expected: &releaseTag{Language: "ts", PatchVersion: "v1.0.0"},
+		},
+		{
+			name:     "version of another release",
+			files:    map[string]string{"functions/go/apply-setters/VERSION": "v0.2.1"},
+			errorMsg: `version "v0.2.1"`,
+		},
+		{
+			name:     "minor version",
+			files:    map[string]string{"functions/go/apply-setters/VERSION": "v1.0"},
+			errorMsg: `version "v1.0"`,
+		},
+		{
+			name:     "prerelease version",
+			files:    map[string]string{"functions/go/apply-setters/VERSION": "v1.0.2-rc.1"},
+			errorMsg: `version "v1.0.2-rc.1"`,
+		},
+		{
+			name:     "build metadata",
+			files:    map[string]string{"functions/go/apply-setters/VERSION": "v1.0.2+build.5"},
+			errorMsg: `version "v1.0.2+build.5"`,
+		},
+		{
+			name: "Kptfile version",
+			files: map[string]string{"functions/go/apply-setters/Kptfile": "apiVersion: kpt.dev/v1\nkind: Kptfile\n" +
+				"info:\n  version: v1.0.3\n"},
+			expected: &releaseTag{Language: "go", PatchVersion: "v1.0.3"},
+		},
+		{
+			name: "VERSION file over the Kptfile",
+			files: map[string]string{
+				"functions/go/apply-setters/VERSION": "v1.0.2\n",
+				"functions/go/apply-setters/Kptfile": "info:\n  version: v1.0.3\n",
+			},
+			expected: &releaseTag{Language: "go", PatchVersion: "v1.0.2"},
+		},
+		{
+			name:     "Kptfile without a version",
+			files:    map[string]string{"functions/go/apply-setters/Kptfile": "apiVersion: kpt.dev/v1\nkind: Kptfile\n"},
+			expected: nil,
+		},
+		{
+			name:     "Kptfile version of another release",
+			files:    map[string]string{"functions/go/apply-setters/Kptfile": "info:\n  version: v0.2.1\n"},
+			errorMsg: filepath.Join("apply-setters", "Kptfile") + " does not match",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoBase := t.TempDir()
+			writeFiles(t, repoBase, tc.files)
+			fr := &functionRelease{FunctionName: "apply-setters", MinorVersion: "v1.0"}
+			actual, err := fr.readFileVersion(repoBase)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestInsertPins(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		opts:               releaseOptions{Registries: []string{"ghcr.io/example/kpt-fn"}},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "unversioned image",
+			input:    "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters -- replicas=3\n",
+			expected: "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters:v1.0.1 -- replicas=3\n",
+		},
+		{
+			name:     "unversioned image at the end of the doc",
+			input:    "image: gcr.io/kpt-fn/apply-setters",
+			expected: "image: gcr.io/kpt-fn/apply-setters:v1.0.1",
+		},
+		{
+			name:     "versioned image",
+			input:    "image: gcr.io/kpt-fn/apply-setters:unstable\n",
+			expected: "image: gcr.io/kpt-fn/apply-setters:unstable\n",
+		},
+		{
+			name:     "unversioned image of an extra registry",
+			input:    "image: ghcr.io/example/kpt-fn/apply-setters\n",
+			expected: "image: ghcr.io/example/kpt-fn/apply-setters:v1.0.1\n",
+		},
+		{
+			name:     "unversioned image of an unknown registry",
+			input:    "image: example.com/kpt-fn/apply-setters\n",
+			expected: "image: example.com/kpt-fn/apply-setters\n",
+		},
+		{
+			name:     "image of another function",
+			input:    "image: gcr.io/kpt-fn/apply-setters-extra\n",
+			expected: "image: gcr.io/kpt-fn/apply-setters-extra\n",
+		},
+		{
+			name:     "unversioned catalog URLs",
+			input:    "[docs](https://catalog.kpt.dev/apply-setters/) https://catalog.kpt.dev/apply-setters\n",
+			expected: "[docs](https://catalog.kpt.dev/apply-setters/v1.0/) https://catalog.kpt.dev/apply-setters/v1.0\n",
+		},
+		{
+			name:     "versioned catalog URL",
+			input:    "https://catalog.kpt.dev/apply-setters/v0.2/\n",
+			expected: "https://catalog.kpt.dev/apply-setters/v0.2/\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, _ := fr.insertPins([]byte(tc.input))
+			actual := string(updated)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+			// inserting the pins again is a no-op
+			if again, _ := fr.insertPins(updated); string(again) != actual {
+				t.Errorf("expected idempotent insert %s, got %s", actual, again)
+			}
+		})
+	}
+
+	// the function name is matched literally
+	dotted := &functionRelease{FunctionName: "set.labels", MinorVersion: "v1.0", LatestPatchVersion: "v1.0.1"}
+	input := "image: gcr.io/kpt-fn/set-labels\n"
+	if updated, _ := dotted.insertPins([]byte(input)); string(updated) != input {
+		t.Errorf("expected another function's image to be untouched, got %s", updated)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-advanced/\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-ref?ref=main\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-fragment/#section\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple?ref=main\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/functions/go/apply-setters/examples/apply-setters-colocated\n",
+		"examples/apply-setters-simple/README.md":                               "",
+		"examples/apply-setters-advanced/README.md":                             "",
+		"examples/apply-setters-ref/README.md":                                  "",
+		"examples/apply-setters-fragment/README.md":                             "",
+		"functions/go/apply-setters/examples/apply-setters-colocated/README.md": "",
+	})
+	// filesystem paths use the OS separator while URLs always use slashes
+	examplesPath := filepath.Join(repoBase, filepath.FromSlash("examples"))
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, filepath.FromSlash("functions/go/apply-setters")),
+	}
+	if err := fr.parseMetadata(examplesPath); err != nil {
+		t.Fatal(err)
+	}
+	expected := functionExamples{
+		{
+			ExamplePath: filepath.Join(examplesPath, "apply-setters-simple"),
+			ExampleName: "apply-setters-simple",
+		},
+		{
+			ExamplePath: filepath.Join(examplesPath, "apply-setters-advanced"),
+			ExampleName: "apply-setters-advanced",
+		},
+		{
+			ExamplePath: filepath.Join(examplesPath, "apply-setters-ref"),
+			ExampleName: "apply-setters-ref",
+		},
+		{
+			ExamplePath: filepath.Join(examplesPath, "apply-setters-fragment"),
+			ExampleName: "apply-setters-fragment",
+		},
+		{
+			ExamplePath: filepath.Join(fr.FunctionPath, "examples", "apply-setters-colocated"),
+			ExampleName: "apply-setters-colocated",
+			Colocated:   true,
+		},
+	}
+	if !reflect.DeepEqual(expected, fr.Examples) {
+		t.Errorf("expected %+v, got %+v", expected, fr.Examples)
+	}
+}
+
+func TestParseMetadataExampleGlob(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-*\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/set-labels-*\n",
+		"examples/apply-setters-simple/README.md":   "",
+		"examples/apply-setters-advanced/README.md": "",
+		"examples/apply-setters-nested/README.md":   "",
+		"examples/apply-setters-file.md":            "",
+		"examples/set-namespace-simple/README.md":   "",
+	})
+	examplesPath := filepath.Join(repoBase, "examples")
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, "functions", "go", "apply-setters"),
+	}
+	if err := fr.parseMetadata(examplesPath); err != nil {
+		t.Fatal(err)
+	}
+	// the glob matches the dirs only, the listed example isn't repeated and
+	// the glob matching nothing is skipped
+	expected := []string{"apply-setters-simple", "apply-setters-advanced", "apply-setters-nested"}
+	if actual := fr.Examples.exampleNames(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestParseMetadataFilename(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n",
+		"functions/go/apply-setters/fn-meta.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-advanced\n",
+		"functions/go/set-labels/metadata.json": `{"examplePackageURLs": [` +
+			`"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/set-labels-simple"]}`,
+		"examples/apply-setters-simple/README.md":   "",
+		"examples/apply-setters-advanced/README.md": "",
+		"examples/set-labels-simple/README.md":      "",
+	})
+	examplesPath := filepath.Join(repoBase, "examples")
+	testCases := []struct {
+		name             string
+		functionName     string
+		metadataFilename string
+		expected         []string
+	}{
+		{name: "default", functionName: "apply-setters", expected: []string{"apply-setters-simple"}},
+		{name: "custom", functionName: "apply-setters", metadataFilename: "fn-meta.yaml",
+			expected: []string{"apply-setters-advanced"}},
+		{name: "json fallback", functionName: "set-labels", expected: []string{"set-labels-simple"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: tc.functionName,
+				FunctionPath: filepath.Join(repoBase, "functions", "go", tc.functionName),
+				opts:         releaseOptions{MetadataFilename: tc.metadataFilename},
+			}
+			if err := fr.parseMetadata(examplesPath); err != nil {
+				t.Fatal(err)
+			}
+			if actual := fr.Examples.exampleNames(); !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, "functions", "go", "apply-setters"),
+		opts:         releaseOptions{MetadataFilename: "missing.yaml"},
+	}
+	if err := fr.parseMetadata(examplesPath); err == nil {
+		t.Error("expected a missing metadata file to fail")
+	}
+}
+
+func TestExcludeExamples(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+			{ExampleName: "apply-setters-broken"},
+		},
+	}
+	fr.excludeExamples([]string{"apply-setters-broken", "apply-setters-missing"})
+	if expected := (functionExamples{{ExampleName: "apply-setters-simple"}}); !reflect.DeepEqual(expected, fr.Examples) {
+		t.Errorf("expected examples %+v, got %+v", expected, fr.Examples)
+	}
+	if expected := []string{"apply-setters-broken"}; !reflect.DeepEqual(expected, fr.excludedExamples) {
+		t.Errorf("expected excluded examples %v, got %v", expected, fr.excludedExamples)
+	}
+}
+
+func TestSelectOnlyExample(t *testing.T) {
+	examples := functionExamples{
+		{ExampleName: "apply-setters-simple"},
+		{ExampleName: "apply-setters-broken"},
+	}
+	fr := &functionRelease{FunctionName: "apply-setters", Examples: examples}
+	if err := fr.selectOnlyExample("apply-setters-broken"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (functionExamples{{ExampleName: "apply-setters-broken"}}); !reflect.DeepEqual(expected, fr.Examples) {
+		t.Errorf("expected examples %+v, got %+v", expected, fr.Examples)
+	}
+
+	fr = &functionRelease{FunctionName: "apply-setters", Examples: examples}
+	err := fr.selectOnlyExample("apply-setters-missing")
+	if err == nil || !strings.Contains(err.Error(), "apply-setters-missing is not an example of apply-setters") {
+		t.Errorf("expected an error for the missing example, got %v", err)
+	}
+	if !reflect.DeepEqual(examples, fr.Examples) {
+		t.Errorf("expected examples %+v, got %+v", examples, fr.Examples)
+	}
+}
+
+func TestCheckExamplesRequired(t *testing.T) {
+	testCases := []struct {
+		name     string
+		required string
+		contrib  bool
+		examples functionExamples
+		errorMsg string
+	}{
+		{
+			name:     "not required",
+			required: examplesRequiredNone,
+		},
+		{
+			name:     "required for all functions",
+			required: examplesRequiredAll,
+			contrib:  true,
+			errorMsg: "function apply-setters has no examples, examples are required",
+		},
+		{
+			name:     "required for stable functions",
+			required: examplesRequiredStable,
+			errorMsg: "examples are required for stable functions",
+		},
+		{
+			name:     "contrib function without examples",
+			required: examplesRequiredStable,
+			contrib:  true,
+		},
+		{
+			name:     "stable function with examples",
+			required: examplesRequiredStable,
+			examples: functionExamples{{ExampleName: "apply-setters-simple"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: "apply-setters",
+				IsContrib:    tc.contrib,
+				Examples:     tc.examples,
+				opts:         releaseOptions{ExamplesRequired: tc.required},
+			}
+			err := fr.checkExamplesRequired()
+			if tc.errorMsg == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+				t.Errorf("expected error %q, got %v", tc.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestParseMetadataExampleWithoutReadme(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n",
+		"examples/apply-setters-simple/Kptfile": "",
+	})
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, "functions", "go", "apply-setters"),
+	}
+	err := fr.parseMetadata(filepath.Join(repoBase, "examples"))
+	if err == nil || !strings.Contains(err.Error(), "example apply-setters-simple has no README.md") {
+		t.Errorf("expected missing README error, got %v", err)
+	}
+}
+
+func TestParseMetadataAmbiguousExamples(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/first/simple\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/second/simple\n",
+		"examples/simple/README.md": "",
+	})
+	fr := &functionRelease{
+		FunctionName: "apply-setters",
+		FunctionPath: filepath.Join(repoBase, "functions", "go", "apply-setters"),
+	}
+	err := fr.parseMetadata(filepath.Join(repoBase, "examples"))
+	if err == nil || !strings.Contains(err.Error(), "both resolve to example dir simple") {
+		t.Errorf("expected ambiguous example error, got %v", err)
+	}
+}
+
+func TestCheckSharedExamples(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/simple\n",
+		"functions/go/set-labels/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/simple\n",
+		"functions/go/set-namespace/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/set-namespace-simple\n",
+		"contrib/functions/go/set-namespace/metadata.yaml": "examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/contrib/examples/set-namespace-simple\n",
+		"functions/go/broken/metadata.yaml":               "examplePackageURLs: [\n",
+		"examples/simple/README.md":                       "",
+		"examples/set-namespace-simple/README.md":         "",
+		"contrib/examples/set-namespace-simple/README.md": "",
+	})
+	defer func(indexes map[string][]sharedExample) { sharedExampleIndexes = indexes }(sharedExampleIndexes)
+	sharedExampleIndexes = map[string][]sharedExample{}
+	defer func(count int) { warningCount = count }(warningCount)
+	defer func(out *os.File) { levelWarn.out = out }(levelWarn.out)
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	levelWarn.out = f
+	warningCount = 0
+	testCases := []struct {
+		name         string
+		functionPath string
+		examplesPath string
+		errorMsg     string
+	}{
+		{
+			name:         "example shared with another function",
+			functionPath: "functions/go/apply-setters",
+			examplesPath: "examples",
+			errorMsg:     "is shared with set-labels",
+		},
+		{
+			name:         "same example name in stable and contrib examples",
+			functionPath: "functions/go/set-namespace",
+			examplesPath: "examples",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionPath: filepath.Join(repoBase, filepath.FromSlash(tc.functionPath)),
+			}
+			if err := fr.parseMetadata(filepath.Join(repoBase, filepath.FromSlash(tc.examplesPath))); err != nil {
+				t.Fatal(err)
+			}
+			err := fr.checkSharedExamples(repoBase)
+			if tc.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tc.errorMsg, err)
+			}
+		})
+	}
+	// the index is built once, warning once of the other function's
+	// unreadable metadata
+	if warningCount != 1 {
+		t.Errorf("expected a warning of the unreadable metadata, got %d", warningCount)
+	}
+}
+
+func TestReplaceVersionsCount(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+	}
+	testCases := []struct {
+		name     string
+		input    string
+		expected replaceCount
+	}{
+		{
+			name: "stale references",
+			input: "image: gcr.io/kpt-fn/apply-setters:v0.2.0\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.1/\n" +
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n",
+			expected: replaceCount{Matches: 3, Replaced: 3},
+		},
+		{
+			name: "current references",
+			input: "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+				"https://catalog.kpt.dev/apply-setters/v0.2/\n" +
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/apply-setters/v0.2/examples/apply-setters-simple\n",
+			expected: replaceCount{Matches: 3, Replaced: 0},
+		},
+		{
+			name: "references in HTML anchors",
+			input: `<a href="https://catalog.kpt.dev/apply-setters/v0.1">catalog</a>` + "\n" +
+				`<a href="https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple">package</a>` + "\n",
+			expected: replaceCount{Matches: 2, Replaced: 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, actual := fr.replaceVersions([]byte(tc.input))
+			if actual != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func BenchmarkReplaceVersions(b *testing.B) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+			{ExampleName: "apply-setters-advanced"},
+		},
+	}
+	doc := []byte("image: gcr.io/kpt-fn/apply-setters:v0.2.0\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.1/\n" +
+		"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple\n" +
+		"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-advanced\n")
+	// the docs of a bulk run over the catalog
+	const docs = 100
+	b.Run("compiled once", func(b *testing.B) {
+		fr.patterns = fr.compilePatterns()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < docs; j++ {
+				fr.replaceVersions(doc)
+			}
+		}
+	})
+	b.Run("compiled per doc", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < docs; j++ {
+				fr.patterns = nil
+				fr.replaceVersions(doc)
+			}
+		}
+	})
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.1",
+		opts:               releaseOptions{Placeholder: "__VERSION__"},
+	}
+	input := "image: gcr.io/kpt-fn/apply-setters:__VERSION__\n" +
+		"tag: apply-setters/__VERSION__, other: set-labels:__VERSION__\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.1/\n"
+	expected := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+		"tag: apply-setters/v0.2.1, other: set-labels:__VERSION__\n" +
+		"https://catalog.kpt.dev/apply-setters/v0.2/\n"
+	actual, _ := fr.replaceVersions([]byte(input))
+	if string(actual) != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestReadExampleURLs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata string
+		expected []string
+		errorMsg string
+	}{
+		{
+			name: "sequence",
+			metadata: "examplePackageURLs:\n" +
+				"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n" +
+				"  - \"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-advanced\"\n",
+			expected: []string{
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple",
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-advanced",
+			},
+		},
+		{
+			name:     "quoted scalar",
+			metadata: "examplePackageURLs: 'https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple'\n",
+			expected: []string{
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple",
+			},
+		},
+		{
+			name:     "missing",
+			metadata: "image: gcr.io/kpt-fn/apply-setters\n",
+			expected: nil,
+		},
+		{
+			name:     "mapping",
+			metadata: "examplePackageURLs:\n  simple: https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/apply-setters-simple\n",
+			errorMsg: "expected a string or a list of strings",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metadataPath := filepath.Join(t.TempDir(), "metadata.yaml")
+			writeFiles(t, filepath.Dir(metadataPath), map[string]string{"metadata.yaml": tc.metadata})
+			actual, err := readExampleURLs(metadataPath)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceImages(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		LatestPatchVersion: "v1.0.1",
+		opts: releaseOptions{
+			Registries: []string{"us-docker.pkg.dev/kpt-fn/mirror/"},
+		},
+	}
+	input := "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters:v1.0.0\n" +
+		"$ kpt fn eval --image us-docker.pkg.dev/kpt-fn/mirror/apply-setters:unstable\n" +
+		"$ kpt fn eval --image example.com/apply-setters:v0.1\n"
+	expected := "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters:v1.0.1\n" +
+		"$ kpt fn eval --image us-docker.pkg.dev/kpt-fn/mirror/apply-setters:v1.0.1\n" +
+		"$ kpt fn eval --image example.com/apply-setters:v1.0.1\n"
+	actual, count := fr.replaceVersions([]byte(input))
+	if string(actual) != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	// images in the registries are only counted by replaceImages
+	if expectedCount := (replaceCount{Matches: 3, Replaced: 3}); count != expectedCount {
+		t.Errorf("expected %+v, got %+v", expectedCount, count)
+	}
+}
+
+func TestReadExampleVersions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		versions string
+		expected string
+		errorMsg string
+	}{
+		{
+			name:     "example pinned to another version",
+			versions: "apply-setters-simple: v1.0.0\n",
+			expected: "https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple@apply-setters/v1.0.0\n" +
+				"https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-advanced@apply-setters/v1.0.1\n",
+		},
+		{
+			name:     "unknown example",
+			versions: "apply-setters-simpel: v1.0.0\n",
+			errorMsg: "unknown example apply-setters-simpel",
+		},
+		{
+			name:     "invalid version",
+			versions: "apply-setters-simple: latest\n",
+			errorMsg: `invalid version "latest"`,
+		},
+	}
+	input := "https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-simple\n" +
+		"https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/apply-setters-advanced\n"
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"versions.yaml": tc.versions})
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				LatestPatchVersion: "v1.0.1",
+				Examples: functionExamples{
+					{ExampleName: "apply-setters-simple"},
+					{ExampleName: "apply-setters-advanced"},
+				},
+			}
+			err := fr.readExampleVersions(filepath.Join(dir, "versions.yaml"))
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, _ := fr.replaceKptPackages([]byte(input))
+			if string(actual) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUpdateDocMaxFileSize(t *testing.T) {
+	stale := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n"
+	testCases := []struct {
+		name          string
+		maxFileSize   int64
+		expected      string
+		expectSkipped bool
+	}{
+		{
+			name:        "doc within the limit is updated",
+			maxFileSize: int64(len(stale)),
+			expected:    "image: gcr.io/kpt-fn/apply-setters:v0.2.2\n",
+		},
+		{
+			name:          "doc over the limit is skipped",
+			maxFileSize:   int64(len(stale)) - 1,
+			expected:      stale,
+			expectSkipped: true,
+		},
+		{
+			name:        "no limit",
+			maxFileSize: 0,
+			expected:    "image: gcr.io/kpt-fn/apply-setters:v0.2.2\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v0.2",
+				LatestPatchVersion: "v0.2.2",
+				opts:               releaseOptions{MaxFileSize: tc.maxFileSize},
+			}
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"README.md": stale})
+			path := filepath.Join(dir, "README.md")
+			if err := fr.updateDoc(path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := readFile(t, path); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+			if skipped := len(fr.oversizedDocs) > 0; skipped != tc.expectSkipped {
+				t.Errorf("expected skipped %v, got %v", tc.expectSkipped, skipped)
+			}
+		})
+	}
+}
+
+func TestUpdateDocMaxFileSizeTree(t *testing.T) {
+	repo := setupRepo(t)
+	stale := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n"
+	writeFiles(t, repo, map[string]string{"README.md": stale + stale})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "add README")
+	// the working tree copy is within the limit, the committed one isn't
+	writeFiles(t, repo, map[string]string{"README.md": stale})
+	tree, err := readGitTree("HEAD", repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.2",
+		opts:               releaseOptions{MaxFileSize: int64(len(stale))},
+		tree:               tree,
+	}
+	path := filepath.Join(repo, "README.md")
+	if err = fr.updateDoc(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fr.oversizedDocs) != 1 || fr.oversizedDocs[0] != path {
+		t.Errorf("expected the committed README to be skipped, got %v", fr.oversizedDocs)
+	}
+}
+
+func TestUpdateDocBOM(t *testing.T) {
+	bom := "\xef\xbb\xbf"
+	stale := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n"
+	current := "image: gcr.io/kpt-fn/apply-setters:v0.2.2\n"
+	testCases := []struct {
+		name     string
+		contents string
+		stripBOM bool
+		expected string
+	}{
+		{
+			name:     "BOM is preserved",
+			contents: bom + stale,
+			expected: bom + current,
+		},
+		{
+			name:     "BOM is stripped",
+			contents: bom + stale,
+			stripBOM: true,
+			expected: current,
+		},
+		{
+			name:     "current doc with a BOM is stripped",
+			contents: bom + current,
+			stripBOM: true,
+			expected: current,
+		},
+		{
+			name:     "no BOM",
+			contents: stale,
+			expected: current,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"README.md": tc.contents})
+			path := filepath.Join(dir, "README.md")
+			// the second run finds the doc current and leaves it untouched
+			for run := 1; run <= 2; run++ {
+				fr := &functionRelease{
+					FunctionName:       "apply-setters",
+					MinorVersion:       "v0.2",
+					LatestPatchVersion: "v0.2.2",
+					opts:               releaseOptions{StripBOM: tc.stripBOM},
+				}
+				if err := fr.updateDoc(path); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if actual := readFile(t, path); actual != tc.expected {
+					t.Errorf("run %d: expected %q, got %q", run, tc.expected, actual)
+				}
+				if run == 2 && fr.hasUpdates() {
+					t.Errorf("run %d: expected no updates, got %+v", run, fr.docUpdates)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateDocOnConflict(t *testing.T) {
+	modified := "image: gcr.io/kpt-fn/apply-setters:v0.1.3\n"
+	testCases := []struct {
+		name       string
+		onConflict string
+		contents   string
+		expected   string
+		errorMsg   string
+	}{
+		{
+			name:       "stale doc is updated",
+			onConflict: onConflictError,
+			contents:   "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n",
+			expected:   "image: gcr.io/kpt-fn/apply-setters:v0.2.2\n",
+		},
+		{
+			name:       "modified doc is overwritten",
+			onConflict: onConflictOverwrite,
+			contents:   modified,
+			expected:   "image: gcr.io/kpt-fn/apply-setters:v0.2.2\n",
+		},
+		{
+			name:       "modified doc is skipped",
+			onConflict: onConflictSkip,
+			contents:   modified,
+			expected:   modified,
+		},
+		{
+			name:       "modified doc fails",
+			onConflict: onConflictError,
+			contents:   modified,
+			expected:   modified,
+			errorMsg:   "references unexpected versions",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:         "apply-setters",
+				MinorVersion:         "v0.2",
+				LatestPatchVersion:   "v0.2.2",
+				PreviousPatchVersion: "v0.2.1",
+				opts:                 releaseOptions{OnConflict: tc.onConflict},
+			}
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"README.md": tc.contents})
+			path := filepath.Join(dir, "README.md")
+			err := fr.updateDoc(path)
+			if tc.errorMsg == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.errorMsg != "" && (err == nil || !strings.Contains(err.Error(), tc.errorMsg)) {
+				t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+			}
+			if actual := readFile(t, path); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUpdateTranslatedDocs(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"docs/i18n/ja/functions/apply-setters/README.md":       "image: gcr.io/kpt-fn/apply-setters:v0.2.0\n",
+		"docs/i18n/ja/examples/apply-setters-simple/README.md": "https://catalog.kpt.dev/apply-setters/v0.1/\n",
+		"docs/i18n/fr/functions/set-labels/README.md":          "image: gcr.io/kpt-fn/set-labels:v0.1.0\n",
+	})
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.1",
+		Examples: functionExamples{
+			{ExampleName: "apply-setters-simple"},
+		},
+		opts: releaseOptions{
+			RepoDir:          repoBase,
+			TranslationsDirs: []string{"docs/i18n/ja", filepath.Join(repoBase, "docs", "i18n", "fr")},
+		},
+	}
+	if err := fr.updateTranslatedDocs(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"docs/i18n/ja/functions/apply-setters/README.md":       "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n",
+		"docs/i18n/ja/examples/apply-setters-simple/README.md": "https://catalog.kpt.dev/apply-setters/v0.2/\n",
+		"docs/i18n/fr/functions/set-labels/README.md":          "image: gcr.io/kpt-fn/set-labels:v0.1.0\n",
+	}
+	for name, contents := range expected {
+		if actual := readFile(t, filepath.Join(repoBase, filepath.FromSlash(name))); actual != contents {
+			t.Errorf("expected %s to be %q, got %q", name, contents, actual)
+		}
+	}
+}
+
+func TestReadDocPathsTierRestrict(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/metadata.yaml":      "",
+		"contrib/functions/go/set-labels/metadata.yaml": "",
+	})
+	testCases := []struct {
+		functionName string
+		tier         string
+		errorMsg     string
+	}{
+		{functionName: "apply-setters"},
+		{functionName: "apply-setters", tier: tierStable},
+		{functionName: "apply-setters", tier: tierContrib,
+			errorMsg: "function apply-setters is a stable function, -tier-restrict only allows contrib functions"},
+		{functionName: "set-labels", tier: tierContrib},
+		{functionName: "set-labels", tier: tierStable,
+			errorMsg: "function set-labels is a contrib function, -tier-restrict only allows stable functions"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.functionName+"/"+tc.tier, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName: tc.functionName,
+				Language:     "go",
+				opts:         releaseOptions{RepoDir: repoBase, TierRestrict: tc.tier},
+			}
+			err := fr.readDocPaths()
+			if tc.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.errorMsg {
+				t.Errorf("expected error %q, got %v", tc.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestUpdateDocsScope(t *testing.T) {
+	stale := "image: gcr.io/kpt-fn/apply-setters:v0.2.0\n"
+	current := "image: gcr.io/kpt-fn/apply-setters:v0.2.1\n"
+	testCases := []struct {
+		name            string
+		opts            releaseOptions
+		expectedFunc    string
+		expectedExample string
+	}{
+		{
+			name:            "all docs",
+			expectedFunc:    current,
+			expectedExample: current,
+		},
+		{
+			name:            "skip examples",
+			opts:            releaseOptions{SkipExamples: true},
+			expectedFunc:    current,
+			expectedExample: stale,
+		},
+		{
+			name:            "skip function doc",
+			opts:            releaseOptions{SkipFunctionDoc: true},
+			expectedFunc:    stale,
+			expectedExample: current,
+		},
+		{
+			name:            "only example",
+			opts:            releaseOptions{OnlyExample: "apply-setters-simple"},
+			expectedFunc:    stale,
+			expectedExample: current,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoBase := t.TempDir()
+			writeFiles(t, repoBase, map[string]string{
+				"functions/go/apply-setters/README.md":     stale,
+				"functions/go/apply-setters/metadata.yaml": "",
+				"examples/apply-setters-simple/README.md":  stale,
+			})
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v0.2",
+				LatestPatchVersion: "v0.2.1",
+				FunctionPath:       filepath.Join(repoBase, "functions", "go", "apply-setters"),
+				Examples: functionExamples{
+					{
+						ExamplePath: filepath.Join(repoBase, "examples", "apply-setters-simple"),
+						ExampleName: "apply-setters-simple",
+					},
+				},
+				opts: tc.opts,
+			}
+			if err := fr.updateDocs(); err != nil {
+				t.Fatal(err)
+			}
+			if actual := readFile(t, filepath.Join(fr.FunctionPath, "README.md")); actual != tc.expectedFunc {
+				t.Errorf("expected function README %q, got %q", tc.expectedFunc, actual)
+			}
+			if actual := readFile(t, filepath.Join(fr.Examples[0].ExamplePath, "README.md")); actual != tc.expectedExample {
+				t.Errorf("expected example README %q, got %q", tc.expectedExample, actual)
+			}
+		})
+	}
+}
+
+func TestUpdateDocsFunctionReadmeURLVersion(t *testing.T) {
+	stale := "See https://catalog.kpt.dev/apply-setters/v0.1/\n"
+	testCases := []struct {
+		name            string
+		urlVersion      string
+		expectedFunc    string
+		expectedExample string
+	}{
+		{
+			name:            "minor",
+			urlVersion:      urlVersionMinor,
+			expectedFunc:    "See https://catalog.kpt.dev/apply-setters/v0.2/\n",
+			expectedExample: "See https://catalog.kpt.dev/apply-setters/v0.2/\n",
+		},
+		{
+			name:            "patch",
+			urlVersion:      urlVersionPatch,
+			expectedFunc:    "See https://catalog.kpt.dev/apply-setters/v0.2.1/\n",
+			expectedExample: "See https://catalog.kpt.dev/apply-setters/v0.2/\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoBase := t.TempDir()
+			writeFiles(t, repoBase, map[string]string{
+				"functions/go/apply-setters/README.md":     stale,
+				"functions/go/apply-setters/metadata.yaml": "",
+				"examples/apply-setters-simple/README.md":  stale,
+			})
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v0.2",
+				LatestPatchVersion: "v0.2.1",
+				FunctionPath:       filepath.Join(repoBase, "functions", "go", "apply-setters"),
+				Examples: functionExamples{
+					{
+						ExamplePath: filepath.Join(repoBase, "examples", "apply-setters-simple"),
+						ExampleName: "apply-setters-simple",
+					},
+				},
+				opts: releaseOptions{FunctionReadmeURLVersion: tc.urlVersion},
+			}
+			// the second run leaves the docs pinned to the same versions
+			for i := 0; i < 2; i++ {
+				if err := fr.updateDocs(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if actual := readFile(t, filepath.Join(fr.FunctionPath, "README.md")); actual != tc.expectedFunc {
+				t.Errorf("expected function README %q, got %q", tc.expectedFunc, actual)
+			}
+			if actual := readFile(t, filepath.Join(fr.Examples[0].ExamplePath, "README.md")); actual != tc.expectedExample {
+				t.Errorf("expected example README %q, got %q", tc.expectedExample, actual)
+			}
+		})
+	}
+}
+
+func TestDocsBranch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		functionName string
+		prefix       string
+		expected     string
+	}{
+		{
+			name:         "default prefix",
+			functionName: "apply-setters",
+			prefix:       defaultBranchPrefix,
+			expected:     "docs/update-apply-setters-v1.0.1",
+		},
+		{
+			name:         "custom prefix",
+			functionName: "apply-setters",
+			prefix:       "bot/docs-",
+			expected:     "bot/docs-apply-setters-v1.0.1",
+		},
+		{
+			name:         "namespaced function",
+			functionName: "gatekeeper/validate",
+			prefix:       defaultBranchPrefix,
+			expected:     "docs/update-gatekeeper-validate-v1.0.1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:       tc.functionName,
+				LatestPatchVersion: "v1.0.1",
+				opts:               releaseOptions{BranchPrefix: tc.prefix},
+			}
+			actual := fr.docsBranch()
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+			if err := checkBranchName(actual); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckBranchName(t *testing.T) {
+	for _, name := range []string{"docs/update-foo-v1.0.1", "foo-v1.0.1", "release/docs/foo"} {
+		if err := checkBranchName(name); err != nil {
+			t.Errorf("expected %s to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "@", "-docs/foo", "/docs/foo", "docs/", "docs.", "docs//foo", "docs/.foo",
+		"docs.lock/foo", "docs..foo", "docs foo", "docs:foo", "docs@{foo", "docs~foo"} {
+		if err := checkBranchName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
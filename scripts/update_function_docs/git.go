@@ -15,22 +15,64 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	// cmdContext bounds the commands, which are killed once it is done
+	cmdContext = context.Background()
+	// quietGit suppresses the command echo and the git output, stderr is
+	// still included in the errors
+	quietGit = false
 )
 
 func runCmd(name string, arg ...string) (string, error) {
+	return runExecCmd(exec.Command(name, arg...))
+}
+
+// runExecCmd runs the command, capturing its output, until it exits or
+// cmdContext is done
+func runExecCmd(cmd *exec.Cmd) (string, error) {
+	stdout, _, err := runExecCmdOutput(cmd)
+	return stdout, err
+}
+
+// runExecCmdOutput runs the command as runExecCmd does, also returning its
+// stderr, which runExecCmd only includes in the error
+func runExecCmdOutput(cmd *exec.Cmd) (string, string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd := exec.Command(name, arg...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	fmt.Printf("%s\n", cmd.String())
-	err := cmd.Run()
+	if !quietGit {
+		infof("%s", cmd.String())
+	}
+	if err := cmd.Start(); err != nil {
+		return "", "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-cmdContext.Done():
+		// don't wait for the output, which may be held open by the
+		// command's own subprocesses such as git hooks
+		_ = cmd.Process.Kill()
+		return "", "", fmt.Errorf("killed %s: %w", cmd.String(), cmdContext.Err())
+	}
 	if err != nil {
-		return stdout.String(), fmt.Errorf("%s\n%s", stderr.String(), err)
+		return stdout.String(), stderr.String(), fmt.Errorf("%s\n%w", stderr.String(), err)
 	}
-	return stdout.String(), err
+	return stdout.String(), stderr.String(), err
 }
 
 func isCleanRepo() bool {
@@ -41,33 +83,323 @@ func isCleanRepo() bool {
 	return true
 }
 
+// gitStatusPorcelain returns the changed and untracked files of the repo, one
+// per line, or an empty string if the repo is clean
+func gitStatusPorcelain() (string, error) {
+	stdout, err := runCmd("git", "status", "--porcelain")
+	return strings.TrimRight(stdout, "\n"), err
+}
+
+// isWhitespaceOnlyStaged returns true if the staged changes only change
+// whitespace
+func isWhitespaceOnlyStaged() bool {
+	_, err := runCmd("git", "diff", "--cached", "--ignore-all-space", "--quiet")
+	if err != nil {
+		return false
+	}
+	return true
+}
+
+func gitClone(url, dir string) error {
+	_, err := runCmd("git", "clone", url, dir)
+	return err
+}
+
 func gitFetch() error {
 	_, err := runCmd("git", "fetch", "--tags")
 	return err
 }
 
+// gitIsShallow reports whether the repo is a shallow clone, e.g. a CI checkout
+// with fetch-depth: 1, which may lack the tags of the releases
+func gitIsShallow() bool {
+	stdout, err := runCmd("git", "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(stdout) == "true"
+}
+
+// gitUnshallow fetches the full history and the tags of a shallow clone
+func gitUnshallow() error {
+	_, err := runCmd("git", "fetch", "--unshallow", "--tags")
+	return err
+}
+
 func gitCheckout(branch string) error {
 	_, err := runCmd("git", "checkout", branch)
 	return err
 }
 
+// gitCurrentBranch returns the checked out local branch, or "" if HEAD is
+// detached
+func gitCurrentBranch() string {
+	stdout, err := runCmd("git", "symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout)
+}
+
+// gitIsDetached reports whether HEAD is detached, i.e. not on a local branch
+func gitIsDetached() bool {
+	return gitCurrentBranch() == ""
+}
+
+// gitCreateBranch creates the branch at HEAD and switches to it
+func gitCreateBranch(branch string) error {
+	_, err := runCmd("git", "checkout", "-b", branch)
+	return err
+}
+
+// gitCheckoutLocal creates or resets the local branch to ref and checks it out
+func gitCheckoutLocal(branch, ref string) error {
+	_, err := runCmd("git", "checkout", "-B", branch, ref)
+	return err
+}
+
+func gitRemotes() ([]string, error) {
+	stdout, err := runCmd("git", "remote")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout), nil
+}
+
+// remoteBranch returns the branch of ref without the remote, if ref is a
+// remote-tracking branch of one of the remotes, e.g.
+// origin/apply-setters/v0.2 -> apply-setters/v0.2
+func remoteBranch(ref string, remotes []string) (string, bool) {
+	for _, remote := range remotes {
+		if branch := strings.TrimPrefix(ref, remote+"/"); branch != ref && branch != "" {
+			return branch, true
+		}
+	}
+	return "", false
+}
+
+// gitRefExists reports whether the full ref exists, e.g.
+// refs/heads/apply-setters/v0.2
+func gitRefExists(ref string) bool {
+	_, err := runCmd("git", "show-ref", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// resolveBranch resolves a bare branch name to the local branch if there is
+// one, or else the remote-tracking branch of the only remote having it, e.g.
+// apply-setters/v0.2 -> origin/apply-setters/v0.2. Names of neither, such as
+// tags and commits, are returned as is.
+func resolveBranch(name string, remotes []string) (string, error) {
+	if gitRefExists("refs/heads/" + name) {
+		return name, nil
+	}
+	var matches []string
+	for _, remote := range remotes {
+		if gitRefExists("refs/remotes/" + remote + "/" + name) {
+			matches = append(matches, remote+"/"+name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return name, nil
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("branch %s is ambiguous, it matches the remote-tracking branches %s",
+			name, strings.Join(matches, ", "))
+	}
+}
+
+// gitRemoteBranches returns the remote-tracking branches, one per line
+func gitRemoteBranches() (string, error) {
+	return runCmd("git", "branch", "-r")
+}
+
 func gitTag() (string, error) {
 	return runCmd("git", "tag")
 }
 
+// gitVerifyTag returns an error unless the tag has a valid signature
+func gitVerifyTag(tag string) error {
+	_, err := runCmd("git", "tag", "-v", tag)
+	return err
+}
+
+func gitLsRemoteTags(remote, pattern string) (string, error) {
+	return runCmd("git", "ls-remote", "--tags", remote, pattern)
+}
+
+// gitTagDates returns the commit dates of the tags, by tag name, with a single
+// git command rather than one per tag
+func gitTagDates() (map[string]time.Time, error) {
+	// the commit date of lightweight tags, or of the commit annotated tags
+	// point to
+	stdout, err := runCmd("git", "for-each-ref",
+		"--format=%(refname) %(committerdate:iso-strict) %(*committerdate:iso-strict)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	return parseTagDates(stdout)
+}
+
+// parseTagDates parses the git for-each-ref output of gitTagDates
+func parseTagDates(stdout string) (map[string]time.Time, error) {
+	dates := map[string]time.Time{}
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid date of tag %s: %w", fields[0], err)
+		}
+		dates[strings.TrimPrefix(fields[0], "refs/tags/")] = date
+	}
+	return dates, nil
+}
+
+// gitGrep returns the matching lines of the files as <file>:<line>:<text>
+func gitGrep(pattern string, files ...string) (string, error) {
+	stdout, err := runCmd("git", append([]string{"grep", "-n", "-E", pattern, "--"}, files...)...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// no matching lines
+		return "", nil
+	}
+	return stdout, err
+}
+
+// gitHeadCommit returns the SHA of the HEAD commit
+func gitHeadCommit() (string, error) {
+	stdout, err := runCmd("git", "rev-parse", "HEAD")
+	return strings.TrimSpace(stdout), err
+}
+
+// gitCommitFiles returns the files changed by the HEAD commit
+func gitCommitFiles() ([]string, error) {
+	stdout, err := runCmd("git", "diff-tree", "--no-commit-id", "--name-only", "-r", "--root", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout), nil
+}
+
+// gitChangedFiles returns the files changed on HEAD since it diverged from
+// ref
+func gitChangedFiles(ref string) ([]string, error) {
+	stdout, err := runCmd("git", "diff", "--name-only", ref+"...HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout), nil
+}
+
+// gitTagsSince returns the tags reachable from HEAD but not from ref
+func gitTagsSince(ref string) ([]string, error) {
+	stdout, err := runCmd("git", "tag", "--merged", "HEAD", "--no-merged", ref)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout), nil
+}
+
+// gitLogSubjects returns the subjects of the commits in from..to that change
+// files under path, newest first
+func gitLogSubjects(from, to, path string) ([]string, error) {
+	stdout, err := runCmd("git", "log", "--format=%s", from+".."+to, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	var subjects []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+	return subjects, nil
+}
+
+// gitAddFiles adds the files, including untracked files
+func gitAddFiles(files ...string) error {
+	_, err := runCmd("git", append([]string{"add", "--"}, files...)...)
+	return err
+}
+
 func gitAdd() error {
 	_, err := runCmd("git", "add", "-u")
 	return err
 }
 
-func gitCommit(msg string) error {
-	stdout, err := runCmd("git", "commit", "-m", msg)
-	fmt.Printf("%v\n", stdout)
+func gitCommit(msg string, arg ...string) error {
+	stdout, err := runCmd("git", append([]string{"commit", "-m", msg}, arg...)...)
+	printGitOutput(stdout)
+	return err
+}
+
+// gitPush pushes HEAD to the branch of the remote
+func gitPush(remote, branch string) error {
+	_, err := runCmd("git", "push", remote, "HEAD:refs/heads/"+branch)
 	return err
 }
 
 func gitShow() error {
 	stdout, err := runCmd("git", "show")
-	fmt.Printf("%v\n", stdout)
+	printGitOutput(stdout)
+	return err
+}
+
+// gitDiffStat returns the git diff --stat of the staged and unstaged changes
+// of the paths
+func gitDiffStat(paths []string) (string, error) {
+	return runCmd("git", append([]string{"diff", "--stat", "HEAD", "--"}, paths...)...)
+}
+
+// gitRevParseCommit returns the SHA of the commit of the ref
+func gitRevParseCommit(ref string) (string, error) {
+	stdout, err := runCmd("git", "rev-parse", "--verify", ref+"^{commit}")
+	return strings.TrimSpace(stdout), err
+}
+
+// gitLsTree returns the files of the commit's tree as git ls-tree -r -z
+// output, <mode> <type> <object>\t<path> entries separated by NULs
+func gitLsTree(commit string) (string, error) {
+	return runCmd("git", "ls-tree", "-r", "-z", "-l", commit)
+}
+
+// gitCatFileBlob returns the contents of the file of the commit's tree
+func gitCatFileBlob(commit, path string) ([]byte, error) {
+	stdout, err := runCmd("git", "cat-file", "blob", commit+":"+path)
+	return []byte(stdout), err
+}
+
+// gitHashObject writes the contents to the object database as a blob and
+// returns its SHA
+func gitHashObject(contents []byte) (string, error) {
+	cmd := exec.Command("git", "hash-object", "-w", "--stdin")
+	cmd.Stdin = bytes.NewReader(contents)
+	stdout, err := runExecCmd(cmd)
+	return strings.TrimSpace(stdout), err
+}
+
+// gitWithIndex runs git with the index file instead of the repo's index
+func gitWithIndex(index string, arg ...string) (string, error) {
+	cmd := exec.Command("git", arg...)
+	cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+index)
+	return runExecCmd(cmd)
+}
+
+// gitCommitTree writes a commit of the tree with the parent and returns its SHA
+func gitCommitTree(tree, parent, msg string) (string, error) {
+	stdout, err := runCmd("git", "commit-tree", tree, "-p", parent, "-m", msg)
+	return strings.TrimSpace(stdout), err
+}
+
+// gitUpdateRef points the ref at the commit, creating the ref if needed
+func gitUpdateRef(ref, commit string) error {
+	_, err := runCmd("git", "update-ref", ref, commit)
 	return err
 }
+
+func printGitOutput(stdout string) {
+	if !quietGit {
+		fmt.Fprintf(levelInfo.out, "%v\n", stdout)
+	}
+}
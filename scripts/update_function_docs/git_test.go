@@ -0,0 +1,326 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chdir changes the working directory for the duration of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// withCmdTimeout bounds the commands for the duration of the test
+func withCmdTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	cmdContext = ctx
+	t.Cleanup(func() {
+		cancel()
+		cmdContext = context.Background()
+	})
+}
+
+// setupRepo creates a repo with a staged change and chdirs into it
+func setupRepo(t *testing.T) string {
+	t.Helper()
+	setupGitEnv(t)
+	repo := t.TempDir()
+	runGit(t, repo, "init", "-q", "--initial-branch=main")
+	writeFiles(t, repo, map[string]string{"README.md": "# test\n"})
+	runGit(t, repo, "add", "-A")
+	chdir(t, repo)
+	return repo
+}
+
+func TestGitCommitTimeout(t *testing.T) {
+	repo := setupRepo(t)
+	writeFiles(t, repo, map[string]string{
+		".git/hooks/pre-commit": "#!/bin/sh\nsleep 30\n",
+	})
+	if err := os.Chmod(filepath.Join(repo, ".git", "hooks", "pre-commit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	withCmdTimeout(t, 500*time.Millisecond)
+
+	start := time.Now()
+	err := gitCommit("hanging hook")
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the commit to be killed, took %v", elapsed)
+	}
+}
+
+func TestGitCommitNoVerify(t *testing.T) {
+	repo := setupRepo(t)
+	writeFiles(t, repo, map[string]string{
+		".git/hooks/pre-commit": "#!/bin/sh\nexit 1\n",
+	})
+	if err := os.Chmod(filepath.Join(repo, ".git", "hooks", "pre-commit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitCommit("failing hook"); err == nil {
+		t.Fatal("expected the pre-commit hook to fail the commit")
+	}
+	if err := gitCommit("skipped hook", "--no-verify"); err != nil {
+		t.Fatalf("expected the hook to be skipped, got %v", err)
+	}
+}
+
+func TestCommitDocsWhitespaceOnly(t *testing.T) {
+	repo := setupRepo(t)
+	writeFiles(t, repo, map[string]string{"README.md": "# test\nkpt fn eval --image apply-setters:v1.0.0\n"})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+
+	writeFiles(t, repo, map[string]string{"README.md": "# test\nkpt fn eval  --image apply-setters:v1.0.0\n"})
+	err := commitDocs(arguments{}, "whitespace")
+	if err == nil || !strings.Contains(err.Error(), "only whitespace changed") {
+		t.Fatalf("expected a whitespace only error, got %v", err)
+	}
+	if err = commitDocs(arguments{AllowWhitespaceOnly: true}, "whitespace"); err != nil {
+		t.Fatalf("expected the whitespace change to be committed, got %v", err)
+	}
+
+	writeFiles(t, repo, map[string]string{"README.md": "# test\nkpt fn eval  --image apply-setters:v1.0.1\n"})
+	if err = commitDocs(arguments{}, "version"); err != nil {
+		t.Fatalf("expected the version change to be committed, got %v", err)
+	}
+}
+
+func TestRemoteBranch(t *testing.T) {
+	remotes := []string{"origin", "upstream"}
+	testCases := []struct {
+		ref      string
+		expected string
+		isRemote bool
+	}{
+		{ref: "origin/apply-setters/v0.2", expected: "apply-setters/v0.2", isRemote: true},
+		{ref: "upstream/apply-setters/v0.2", expected: "apply-setters/v0.2", isRemote: true},
+		{ref: "apply-setters/v0.2"},
+		{ref: "originals/apply-setters/v0.2"},
+		{ref: "origin/"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			branch, isRemote := remoteBranch(tc.ref, remotes)
+			if branch != tc.expected || isRemote != tc.isRemote {
+				t.Errorf("expected %q, %v, got %q, %v", tc.expected, tc.isRemote, branch, isRemote)
+			}
+		})
+	}
+}
+
+func TestResolveBranch(t *testing.T) {
+	repo := setupRepo(t)
+	runGit(t, repo, "commit", "-q", "-m", "add README")
+	runGit(t, repo, "branch", "local/v0.1")
+	runGit(t, repo, "update-ref", "refs/remotes/origin/local/v0.1", "HEAD")
+	runGit(t, repo, "update-ref", "refs/remotes/upstream/remote/v0.1", "HEAD")
+	runGit(t, repo, "update-ref", "refs/remotes/origin/ambiguous/v0.1", "HEAD")
+	runGit(t, repo, "update-ref", "refs/remotes/upstream/ambiguous/v0.1", "HEAD")
+	remotes := []string{"origin", "upstream"}
+	testCases := []struct {
+		name     string
+		expected string
+		errorMsg string
+	}{
+		{name: "local/v0.1", expected: "local/v0.1"},
+		{name: "remote/v0.1", expected: "upstream/remote/v0.1"},
+		{name: "ambiguous/v0.1", errorMsg: "origin/ambiguous/v0.1, upstream/ambiguous/v0.1"},
+		{name: "unknown/v0.1", expected: "unknown/v0.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := resolveBranch(tc.name, remotes)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckoutReleaseRemoteOnly(t *testing.T) {
+	repo := setupRepo(t)
+	runGit(t, repo, "commit", "-q", "-m", "add README")
+	runGit(t, repo, "remote", "add", "origin", repo)
+	runGit(t, repo, "update-ref", "refs/remotes/origin/foo/v0.1", "HEAD")
+
+	if err := checkoutRelease("foo/v0.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "foo/v0.1" {
+		t.Errorf("expected the local foo/v0.1 branch checked out, got %s", branch)
+	}
+	if upstream := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "@{upstream}")); upstream != "origin/foo/v0.1" {
+		t.Errorf("expected foo/v0.1 to track origin/foo/v0.1, got %s", upstream)
+	}
+}
+
+func TestRequireSignedTags(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	repo := setupRepo(t)
+	key := filepath.Join(t.TempDir(), "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	writeFiles(t, filepath.Dir(key), map[string]string{
+		"allowed_signers": "test@example.com " + readFile(t, key+".pub"),
+	})
+	runGit(t, repo, "config", "gpg.format", "ssh")
+	runGit(t, repo, "config", "user.signingkey", key+".pub")
+	runGit(t, repo, "config", "gpg.ssh.allowedSignersFile", filepath.Join(filepath.Dir(key), "allowed_signers"))
+	runGit(t, repo, "commit", "-q", "-m", "add README")
+	runGit(t, repo, "tag", "-s", "-m", "signed", "functions/go/foo/v0.1.0")
+	runGit(t, repo, "tag", "-a", "-m", "unsigned", "functions/go/foo/v0.1.1")
+
+	fr := &functionRelease{
+		FunctionName: "foo",
+		MinorVersion: "v0.1",
+		opts:         releaseOptions{RequireSignedTags: true},
+	}
+	if err := fr.readLatestPatchVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if fr.LatestPatchVersion != "v0.1.0" {
+		t.Errorf("expected the latest signed tag v0.1.0, got %s", fr.LatestPatchVersion)
+	}
+}
+
+func TestLatestByDate(t *testing.T) {
+	repo := setupRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2021-01-01T00:00:00Z")
+	runGit(t, repo, "commit", "-q", "-m", "older")
+	runGit(t, repo, "tag", "functions/go/foo/v0.1.5")
+	t.Setenv("GIT_COMMITTER_DATE", "2021-02-01T00:00:00Z")
+	runGit(t, repo, "commit", "-q", "--allow-empty", "-m", "newer")
+	// annotated tags are dated by the commit they point to, not the tag
+	t.Setenv("GIT_COMMITTER_DATE", "2020-01-01T00:00:00Z")
+	runGit(t, repo, "tag", "-a", "-m", "release", "functions/go/foo/v0.1.2")
+
+	candidates := []releaseTag{
+		{Tag: "functions/go/foo/v0.1.5", PatchVersion: "v0.1.5"},
+		{Tag: "functions/go/foo/v0.1.2", PatchVersion: "v0.1.2"},
+	}
+	latest, err := latestByDate(candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == nil || latest.Tag != "functions/go/foo/v0.1.2" {
+		t.Errorf("expected the tag of the newer commit, got %+v", latest)
+	}
+	if _, err = latestByDate(append(candidates, releaseTag{Tag: "functions/go/foo/v0.1.6"})); err == nil {
+		t.Error("expected a missing tag to fail")
+	}
+}
+
+func TestShallowCloneMissingTags(t *testing.T) {
+	origin := setupRepo(t)
+	runGit(t, origin, "commit", "-q", "-m", "add README")
+	runGit(t, origin, "tag", "functions/go/foo/v0.1.0")
+	runGit(t, origin, "commit", "-q", "--allow-empty", "-m", "after the release")
+	clone := filepath.Join(t.TempDir(), "clone")
+	runGit(t, origin, "clone", "-q", "--depth", "1", "file://"+origin, clone)
+	chdir(t, clone)
+
+	if !gitIsShallow() {
+		t.Fatal("expected the clone to be shallow")
+	}
+	fr := &functionRelease{FunctionName: "foo", MinorVersion: "v0.1"}
+	err := fr.readLatestPatchVersion()
+	if err == nil || !strings.Contains(err.Error(), "shallow clone") || !strings.Contains(err.Error(), "-unshallow") {
+		t.Fatalf("expected a hint to unshallow the clone, got %v", err)
+	}
+
+	if err = gitUnshallow(); err != nil {
+		t.Fatal(err)
+	}
+	if gitIsShallow() {
+		t.Error("expected the clone to be unshallowed")
+	}
+	if err = fr.readLatestPatchVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if fr.LatestPatchVersion != "v0.1.0" {
+		t.Errorf("expected the fetched tag v0.1.0, got %s", fr.LatestPatchVersion)
+	}
+}
+
+func TestReadLatestPatchVersionSelectByDate(t *testing.T) {
+	repo := setupRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2021-01-01T00:00:00Z")
+	runGit(t, repo, "commit", "-q", "-m", "older")
+	runGit(t, repo, "tag", "functions/go/foo/v0.1.5")
+	t.Setenv("GIT_COMMITTER_DATE", "2021-02-01T00:00:00Z")
+	runGit(t, repo, "commit", "-q", "--allow-empty", "-m", "newer")
+	runGit(t, repo, "tag", "functions/go/foo/v0.1.2")
+	tagsFile := filepath.Join(t.TempDir(), "tags")
+	writeFiles(t, filepath.Dir(tagsFile), map[string]string{
+		"tags": "functions/go/foo/v0.1.2\nfunctions/go/foo/v0.1.5\nfunctions/go/foo/v0.1.6\n",
+	})
+
+	testCases := []struct {
+		name     string
+		opts     releaseOptions
+		expected string
+	}{
+		{name: "semver", opts: releaseOptions{SelectBy: selectBySemver}, expected: "v0.1.5"},
+		{name: "date", opts: releaseOptions{SelectBy: selectByDate}, expected: "v0.1.2"},
+		// v0.1.6 isn't tagged in the repo, so its date is unavailable
+		{name: "date unavailable", opts: releaseOptions{SelectBy: selectByDate, TagsFile: tagsFile}, expected: "v0.1.6"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{FunctionName: "foo", MinorVersion: "v0.1", opts: tc.opts}
+			if err := fr.readLatestPatchVersion(); err != nil {
+				t.Fatal(err)
+			}
+			if fr.LatestPatchVersion != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, fr.LatestPatchVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runPostCommitHook runs the -post-commit-hook shell command after the docs
+// of fr are committed, with the release and the commit in its environment.
+// The hook's output is logged, and a failing hook only fails the run with
+// -hook-required.
+func runPostCommitHook(args arguments, fr *functionRelease) error {
+	if args.PostCommitHook == "" {
+		return nil
+	}
+	commit, err := gitHeadCommit()
+	if err != nil {
+		return err
+	}
+	files, err := hookChangedFiles(args, fr)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", args.PostCommitHook)
+	cmd.Env = append(os.Environ(),
+		"FUNCTION_NAME="+fr.FunctionName,
+		"LANGUAGE="+fr.Language,
+		"MINOR_VERSION="+fr.MinorVersion,
+		"LATEST_PATCH_VERSION="+fr.LatestPatchVersion,
+		"COMMIT_SHA="+commit,
+		// one file per line
+		"CHANGED_FILES="+strings.Join(files, "\n"),
+	)
+	stdout, stderr, err := runExecCmdOutput(cmd)
+	if output := strings.TrimRight(stdout, "\n"); output != "" {
+		infof("%s", output)
+	}
+	// the stderr of a failing hook is in the error
+	if output := strings.TrimRight(stderr, "\n"); output != "" && err == nil {
+		infof("%s", output)
+	}
+	if err != nil {
+		if args.HookRequired {
+			return fmt.Errorf("post-commit hook failed: %w", err)
+		}
+		warnf("post-commit hook failed: %v", err)
+	}
+	return nil
+}
+
+// hookChangedFiles returns the CHANGED_FILES of the hook, the files of the
+// commit, or with -commit-strategy single, whose commit holds the docs of
+// every release, the docs updated for fr, relative to the repo as git lists
+// them
+func hookChangedFiles(args arguments, fr *functionRelease) ([]string, error) {
+	if args.CommitStrategy != commitSingle {
+		return gitCommitFiles()
+	}
+	repoBase, err := fr.repoBase()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, update := range fr.docUpdates {
+		if !update.Updated {
+			continue
+		}
+		file, err := filepath.Rel(repoBase, update.Path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.ToSlash(file))
+	}
+	sort.Strings(files)
+	return files, nil
+}
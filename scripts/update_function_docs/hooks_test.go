@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPostCommitHook(t *testing.T) {
+	repo := setupRepo(t)
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+	commit := strings.TrimSpace(runGit(t, repo, "rev-parse", "HEAD"))
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		Language:           "go",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.2",
+	}
+	envFile := filepath.Join(t.TempDir(), "env")
+
+	hook := `printf '%s %s %s %s %s %s' "$FUNCTION_NAME" "$LANGUAGE" "$MINOR_VERSION" ` +
+		`"$LATEST_PATCH_VERSION" "$COMMIT_SHA" "$CHANGED_FILES" > ` + envFile
+	if err := runPostCommitHook(arguments{PostCommitHook: hook}, fr); err != nil {
+		t.Fatal(err)
+	}
+	expected := "apply-setters go v0.2 v0.2.2 " + commit + " README.md"
+	if actual := readFile(t, envFile); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// the single commit holds the docs of every release, so only the
+	// release's own docs are listed
+	fr.opts.RepoDir = repo
+	fr.docUpdates = []docUpdate{
+		{Path: filepath.Join(repo, "functions", "go", "apply-setters", "README.md"), Updated: true},
+		{Path: filepath.Join(repo, "examples", "apply-setters-simple", "README.md"), Updated: true},
+		{Path: filepath.Join(repo, "functions", "go", "apply-setters", "metadata.yaml")},
+	}
+	if err := runPostCommitHook(arguments{PostCommitHook: hook, CommitStrategy: commitSingle}, fr); err != nil {
+		t.Fatal(err)
+	}
+	expected = "apply-setters go v0.2 v0.2.2 " + commit + " examples/apply-setters-simple/README.md\nfunctions/go/apply-setters/README.md"
+	if actual := readFile(t, envFile); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// the stderr of a successful hook is logged
+	defer func(out *os.File) { levelInfo.out = out }(levelInfo.out)
+	logFile := filepath.Join(t.TempDir(), "log")
+	f, err := os.Create(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	levelInfo.out = f
+	if err = runPostCommitHook(arguments{PostCommitHook: "echo notified >&2"}, fr); err != nil {
+		t.Fatal(err)
+	}
+	if log := readFile(t, logFile); !strings.Contains(log, "notified\n") {
+		t.Errorf("expected the hook's stderr to be logged, got %q", log)
+	}
+
+	if err := runPostCommitHook(arguments{PostCommitHook: "exit 1"}, fr); err != nil {
+		t.Errorf("expected a failing hook to only warn, got %v", err)
+	}
+	err = runPostCommitHook(arguments{PostCommitHook: "exit 1", HookRequired: true}, fr)
+	if err == nil || !strings.Contains(err.Error(), "post-commit hook failed") {
+		t.Errorf("expected the required hook to fail, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// updateJSONDoc updates the version references in the string values of a
+// JSON file. The strings are decoded first, so references with escaped
+// slashes, e.g. gcr.io\/kpt-fn\/apply-setters, are matched, and only the
+// strings that change are re-encoded, leaving the rest of the file as is.
+// Like updateDoc, it honours MaxFileSize and OnConflict.
+func (fr *functionRelease) updateJSONDoc(filePath string) error {
+	if fr.skipOversizedDoc(filePath) {
+		return nil
+	}
+	contents, err := fr.readDoc(filePath)
+	if err != nil {
+		return err
+	}
+	body, hasBOM := splitBOM(contents)
+	if !json.Valid(body) {
+		warnf("skipping %s, not valid JSON", filePath)
+		return nil
+	}
+	// the references are checked in the decoded strings, one per line
+	var values []string
+	if _, err = replaceJSONStrings(body, func(value string) string {
+		values = append(values, value)
+		return value
+	}); err != nil {
+		return fmt.Errorf("updating %s: %w", filePath, err)
+	}
+	if skip, err := fr.skipConflictingDoc(filePath, []byte(strings.Join(values, "\n"))); skip || err != nil {
+		return err
+	}
+	doc := fr.docRelease(filePath)
+	var total replaceCount
+	updated, err := replaceJSONStrings(body, func(value string) string {
+		replaced, count := doc.replaceVersions([]byte(value))
+		total.add(count)
+		return string(replaced)
+	})
+	if err != nil {
+		return fmt.Errorf("updating %s: %w", filePath, err)
+	}
+	fr.recordRewrittenURLs(doc.rewrittenURLs)
+	if hasBOM && !fr.opts.StripBOM {
+		updated = append(append([]byte{}, utf8BOM...), updated...)
+	}
+	changed := !bytes.Equal(contents, updated)
+	fr.recordDocUpdate(filePath, total, changed)
+	if !changed {
+		return nil
+	}
+	fr.recordChange(filePath, contents, updated)
+	return fr.writeDoc(filePath, updated)
+}
+
+// replaceJSONStrings returns the valid JSON contents with the string values,
+// and keys, passed through replace. A replaced string is encoded with escaped
+// slashes if the original was.
+func replaceJSONStrings(contents []byte, replace func(string) string) ([]byte, error) {
+	var out bytes.Buffer
+	for i := 0; i < len(contents); i++ {
+		if contents[i] != '"' {
+			out.WriteByte(contents[i])
+			continue
+		}
+		end := i + 1
+		for contents[end] != '"' {
+			if contents[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		literal := contents[i : end+1]
+		i = end
+		var value string
+		if err := json.Unmarshal(literal, &value); err != nil {
+			return nil, err
+		}
+		replaced := replace(value)
+		if replaced == value {
+			out.Write(literal)
+			continue
+		}
+		encoded, err := encodeJSONString(replaced)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(literal, []byte(`\/`)) {
+			encoded = bytes.ReplaceAll(encoded, []byte("/"), []byte(`\/`))
+		}
+		out.Write(encoded)
+	}
+	return out.Bytes(), nil
+}
+
+// encodeJSONString encodes value as a JSON string without escaping HTML
+// characters
+func encodeJSONString(value string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplaceJSONStrings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "formatting is preserved",
+			input:    "{\n    \"image\": \"old\",\n    \"replicas\": 1,   \"other\": \"kept\"\n}\n",
+			expected: "{\n    \"image\": \"new/value\",\n    \"replicas\": 1,   \"other\": \"kept\"\n}\n",
+		},
+		{
+			name:     "escaped slashes are kept",
+			input:    `["a\/old"]`,
+			expected: `["a\/new\/value"]`,
+		},
+		{
+			name:     "escaped quotes",
+			input:    `{"say \"old\"": "old \"quoted\""}`,
+			expected: `{"say \"new/value\"": "new/value \"quoted\""}`,
+		},
+		{
+			name:     "HTML characters aren't escaped",
+			input:    `"<old>"`,
+			expected: `"<new/value>"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := replaceJSONStrings([]byte(tc.input), func(value string) string {
+				return strings.ReplaceAll(value, "old", "new/value")
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUpdateJSONDoc(t *testing.T) {
+	testCases := []struct {
+		name         string
+		input        string
+		opts         releaseOptions
+		expected     string
+		expectedURLs []string
+	}{
+		{
+			name:     "escaped slashes",
+			input:    "{\n  \"image\": \"gcr.io\\/kpt-fn\\/apply-setters:v0.2.1\"\n}\n",
+			expected: "{\n  \"image\": \"gcr.io\\/kpt-fn\\/apply-setters:v0.2.2\"\n}\n",
+		},
+		{
+			name:         "unescaped slashes",
+			input:        "{\"docs\": \"https://catalog.kpt.dev/apply-setters/v0.1/\", \"n\": 2}\n",
+			expected:     "{\"docs\": \"https://catalog.kpt.dev/apply-setters/v0.2/\", \"n\": 2}\n",
+			expectedURLs: []string{"https://catalog.kpt.dev/apply-setters/v0.2"},
+		},
+		{
+			name:     "package URL as the whole value",
+			input:    "{\"package\": \"https:\\/\\/github.com\\/GoogleContainerTools\\/kpt-functions-catalog.git\\/examples\\/apply-setters-simple\"}\n",
+			expected: "{\"package\": \"https:\\/\\/github.com\\/GoogleContainerTools\\/kpt-functions-catalog.git\\/examples\\/apply-setters-simple@apply-setters\\/v0.2.2\"}\n",
+		},
+		{
+			name:     "doc over -max-file-size is skipped",
+			input:    "{\"image\": \"gcr.io/kpt-fn/apply-setters:v0.2.1\"}\n",
+			opts:     releaseOptions{MaxFileSize: 10},
+			expected: "{\"image\": \"gcr.io/kpt-fn/apply-setters:v0.2.1\"}\n",
+		},
+		{
+			name:     "doc with conflicting references is skipped",
+			input:    "{\"image\": \"gcr.io\\/kpt-fn\\/apply-setters:v0.2.1\", \"old\": \"gcr.io/kpt-fn/apply-setters:v0.1.0\"}\n",
+			opts:     releaseOptions{OnConflict: onConflictSkip},
+			expected: "{\"image\": \"gcr.io\\/kpt-fn\\/apply-setters:v0.2.1\", \"old\": \"gcr.io/kpt-fn/apply-setters:v0.1.0\"}\n",
+		},
+		{
+			name:     "invalid JSON is skipped",
+			input:    "{\"image\": \"gcr.io/kpt-fn/apply-setters:v0.2.1\",}\n",
+			expected: "{\"image\": \"gcr.io/kpt-fn/apply-setters:v0.2.1\",}\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"config.json": tc.input})
+			path := filepath.Join(dir, "config.json")
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v0.2",
+				LatestPatchVersion: "v0.2.2",
+				Language:           "go",
+				Examples:           functionExamples{{ExampleName: "apply-setters-simple"}},
+				opts:               tc.opts,
+			}
+			if err := fr.updateJSONDoc(path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := readFile(t, path); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+			if !reflect.DeepEqual(tc.expectedURLs, fr.rewrittenURLs) {
+				t.Errorf("expected rewritten URLs %v, got %v", tc.expectedURLs, fr.rewrittenURLs)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockPollInterval is how often a held lock file is checked while waiting for
+// it with -lock-timeout
+const lockPollInterval = 100 * time.Millisecond
+
+// acquireLock creates the lock file, waiting up to timeout for another run to
+// remove it, so concurrent runs against the same checkout don't race on the
+// checkout and commit. The returned release removes the lock file. An empty
+// path is no lock. The wait ends early once ctx is done, e.g. on SIGINT.
+func acquireLock(ctx context.Context, lockFile string, timeout time.Duration) (func(), error) {
+	if lockFile == "" {
+		return func() {}, nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockFile)
+				return nil, err
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("lock file %s is held by another run%s, remove it if that run was killed",
+				lockFile, lockOwner(lockFile))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for lock file %s: %w", lockFile, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Remove(lockFile)
+		})
+	}, nil
+}
+
+// lockOwner describes the pid written to the lock file, if it can be read
+func lockOwner(lockFile string) string {
+	contents, err := os.ReadFile(lockFile)
+	if err != nil {
+		return ""
+	}
+	pid := strings.TrimSpace(string(contents))
+	if pid == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (pid %s)", pid)
+}
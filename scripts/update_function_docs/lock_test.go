@@ -0,0 +1,88 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "update-docs.lock")
+	release, err := acquireLock(context.Background(), lockFile, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pid := strings.TrimSpace(readFile(t, lockFile)); pid != fmt.Sprint(os.Getpid()) {
+		t.Errorf("expected the pid %d in the lock file, got %s", os.Getpid(), pid)
+	}
+
+	// a second run fails fast while the lock is held
+	_, err = acquireLock(context.Background(), lockFile, 0)
+	if err == nil || !strings.Contains(err.Error(), "is held by another run (pid ") {
+		t.Errorf("expected the lock to be held, got %v", err)
+	}
+
+	// or waits for it to be released
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		release()
+	}()
+	second, err := acquireLock(context.Background(), lockFile, time.Minute)
+	if err != nil {
+		t.Fatalf("expected the lock once released, got %v", err)
+	}
+	second()
+	// releasing again is a no-op
+	release()
+	if _, err = os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+
+	release, err = acquireLock(context.Background(), "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+}
+
+func TestAcquireLockCanceled(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "update-docs.lock")
+	release, err := acquireLock(context.Background(), lockFile, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	// the wait for the held lock ends once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = acquireLock(ctx, lockFile, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the wait to be canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the wait to end on cancel, took %v", elapsed)
+	}
+}
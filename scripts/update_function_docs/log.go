@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// color log output when the output is a terminal
+	colorAuto = "auto"
+	// always color log output
+	colorAlways = "always"
+	// never color log output
+	colorNever = "never"
+)
+
+type logLevel struct {
+	prefix string
+	color  string
+	out    *os.File
+}
+
+var (
+	levelInfo  = logLevel{out: os.Stdout}
+	levelWarn  = logLevel{prefix: "warning: ", color: "\033[33m", out: os.Stderr}
+	levelError = logLevel{prefix: "error: ", color: "\033[31m", out: os.Stderr}
+
+	// colorMode of the log output, only log output is ever colored
+	colorMode = colorAuto
+	// warningCount is the number of warnings logged by the run, every
+	// warning is logged with warnf so -fail-on-warnings counts them all
+	warningCount = 0
+)
+
+// validColorMode reports whether mode is auto, always or never
+func validColorMode(mode string) bool {
+	switch mode {
+	case colorAuto, colorAlways, colorNever:
+		return true
+	}
+	return false
+}
+
+// isTerminal reports whether f is a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// useColor reports whether to color output written to f
+func useColor(f *os.File) bool {
+	switch colorMode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return isTerminal(f)
+}
+
+func logf(level logLevel, format string, args ...interface{}) {
+	msg := level.prefix + fmt.Sprintf(format, args...)
+	if level.color != "" && useColor(level.out) {
+		msg = level.color + msg + "\033[0m"
+	}
+	fmt.Fprintln(level.out, msg)
+}
+
+func infof(format string, args ...interface{}) {
+	logf(levelInfo, format, args...)
+}
+
+func warnf(format string, args ...interface{}) {
+	warningCount++
+	logf(levelWarn, format, args...)
+}
+
+func errorf(format string, args ...interface{}) {
+	logf(levelError, format, args...)
+}
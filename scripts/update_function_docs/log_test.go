@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogColor(t *testing.T) {
+	testCases := []struct {
+		mode     string
+		expected string
+	}{
+		{
+			mode:     colorNever,
+			expected: "warning: stale docs\n",
+		},
+		{
+			mode:     colorAlways,
+			expected: "\033[33mwarning: stale docs\033[0m\n",
+		},
+		{
+			// a regular file is not a terminal
+			mode:     colorAuto,
+			expected: "warning: stale docs\n",
+		},
+	}
+	defer func(mode string) { colorMode = mode }(colorMode)
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			colorMode = tc.mode
+			level := levelWarn
+			level.out = f
+			logf(level, "stale %s", "docs")
+			actual, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWarningCount(t *testing.T) {
+	defer func(count int) { warningCount = count }(warningCount)
+	defer func(out *os.File) { levelWarn.out = out }(levelWarn.out)
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	levelWarn.out = f
+	warningCount = 0
+	infof("not a warning")
+	warnf("first")
+	warnf("second")
+	if warningCount != 2 {
+		t.Errorf("expected 2 warnings, got %d", warningCount)
+	}
+}
@@ -12,46 +12,693 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 //
-// Usage: update_function_docs -branch <RELEASE_BRANCH>
+// Usage: update_function_docs [update|init] -branch <RELEASE_BRANCH>
 //
 // e.g. update_function_docs -branch origin/apply-setters/v0.2
 //
 // The command will checkout the release branch and update the function/example
 // docs with the latest patch version for the release. If the docs are updated
-// then a commit is created with the changes. The manual steps left to the user
+// then a commit is created with the changes. A remote-tracking release branch
+// is checked out on a local branch, named after the remote branch unless
+// -local-branch is set. The manual steps left to the user
 // are to push the commit to a branch and create a pull request.
+//
+// Docs are expected to reference the previous patch version of the release,
+// i.e. the highest tagged patch version below the latest, or the versions the
+// update pins them to. Docs referencing other versions may have been modified
+// by hand, the -on-conflict flag sets whether they are overwritten, skipped or
+// fail the update.
+//
+// With -clone <URL> the update runs in a fresh clone in a temp directory, which
+// is removed on exit unless -keep-clone is set. With -push the commit is pushed
+// to a docs/update-<function>-<version> branch of the remote, or with another
+// prefix set by -branch-prefix.
+//
+// The release branch can also be a release tag, e.g.
+// functions/go/apply-setters/v0.2.1, to regenerate the docs as they would be
+// for that version. Use -checkout to update a specific commit or tag of the
+// release instead of the head of the branch, and -no-commit to only update the
+// docs in the working tree. When committing on a detached tag or commit
+// checkout, the commit is made on a new docs/update-<function>-<version> branch.
+//
+// With -commit-to-ref <REF> the docs are read from the tree of the release
+// branch and the commit is written to the ref with git plumbing, without a
+// checkout or changing the working tree, e.g. for bots working on bare repos.
+//
+// The verify-all command checks the docs of the current checkout are pinned to
+// the latest release of every function, without changing them, and fails
+// listing the stale docs of each function if any are.
+//
+// The audit command checks every release branch has a tag of its minor version
+// and every tag a release branch, and fails listing the inconsistencies if not.
+//
+// The resolve command prints the latest patch version of a release branch, or
+// with -output json the function name, language and version, without checking
+// out the branch or changing any docs.
+//
+// The inspect command prints the function release of a release branch as JSON,
+// with its language, versions, path and examples as resolved from the tree of
+// the branch, without checking it out or changing any docs.
+//
+// The schema command prints the JSON schema of the function metadata.yaml files
+// or of the config file, e.g. update_function_docs schema metadata
+//
+// In bulk mode, given several release branches or tags, -all for the latest
+// release of every function, or a -manifest of releases, the docs of the
+// current checkout are updated for each release. With -changed-since <REF>
+// only the latest releases of the functions changed or released since the ref
+// are, e.g. for CI runs on push. -commit-strategy sets whether each function is committed
+// separately or all together in a single commit.
+//
+// With -dry-run the docs that would be updated are reported, with a diff of
+// each, without changing them, and the exit code is 3 if any would be, or 0 if
+// none would be. With -push the branch that would be pushed and the title and
+// body of its pull request are previewed.
+//
+// With -from-tag <TAG>, e.g. for tag-triggered CI, the docs of the current
+// checkout are updated for the release tag without checking out a branch.
+//
+// The init command does the same for the first release of a function, and also
+// inserts the version pins into the function/example READMEs where the docs
+// reference the function without a version.
+//
+// The preview-series command renders the function README of the current
+// checkout as it would be pinned to each patch version of a release, without
+// changing the repo.
+//
+// e.g. update_function_docs preview-series -output-dir <DIR> apply-setters/v0.2
+//
+// writes <DIR>/v0.2.0/README.md, <DIR>/v0.2.1/README.md, etc.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/mod/semver"
 )
 
+// exitDocsWouldChange is the exit code of dry runs that would change docs
+const exitDocsWouldChange = 3
+
+// errDocsWouldChange is returned by dry runs that would change docs
+var errDocsWouldChange = errors.New("docs would change")
+
+// errInterrupted is the error of runs ended by SIGINT or SIGTERM
+var errInterrupted = errors.New("interrupted by a signal")
+
 func exitWithErr(err error) {
-	fmt.Fprintf(os.Stderr, "%v\n", err)
+	errorf("%v", err)
 	os.Exit(1)
 }
 
+const (
+	// commit the docs of each function separately in bulk mode
+	commitPerFunction = "per-function"
+	// commit the docs of all functions together in bulk mode
+	commitSingle = "single"
+)
+
+const (
+	// update the docs of a release
+	cmdUpdate = "update"
+	// insert the version pins and update the docs of a first release
+	cmdInit = "init"
+	// render the function README for each patch version of a release
+	cmdPreviewSeries = "preview-series"
+	// check the docs of every function are pinned to its latest release
+	cmdVerifyAll = "verify-all"
+	// print the JSON schema of the metadata or config files
+	cmdSchema = "schema"
+	// check every release branch has a tag and every tag a release branch
+	cmdAudit = "audit"
+	// print the latest patch version of a release
+	cmdResolve = "resolve"
+	// print the function release of a release branch as JSON
+	cmdInspect = "inspect"
+	// print how far the README of each function lags behind its latest release
+	cmdStaleness = "staleness"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
 type arguments struct {
+	Command       string
 	ReleaseBranch string
+	// Schema is the name of the schema printed by the schema command
+	Schema string
+	// ReleaseBranches are the release branches or tags of bulk mode, set when
+	// more than one is given
+	ReleaseBranches []string
+	// All updates the docs of the latest release of every function in bulk
+	// mode
+	All bool
+	// Manifest is a YAML file of the releases of bulk mode, see readManifest
+	Manifest string
+	// ChangedSince is the ref the functions are changed since in bulk mode,
+	// see changedReleaseTags
+	ChangedSince   string
+	CommitStrategy string
+	// FromTag is the release tag to update the docs of the current checkout for
+	FromTag string
+	// Checkout is the commit or tag checked out instead of the release branch
+	Checkout  string
+	NoCommit  bool
+	OutputDir string
+	Timeout   time.Duration
+	// LockFile is created for the duration of the run, failing or waiting up
+	// to LockTimeout if another run holds it, see acquireLock
+	LockFile    string
+	LockTimeout time.Duration
+	// CPUProfile and MemProfile are the files the pprof profiles of the run
+	// are written to
+	CPUProfile string
+	MemProfile string
+	NoVerify   bool
+	QuietGit   bool
+	// Unshallow fetches the full history and the tags of a shallow clone
+	// before the run
+	Unshallow bool
+	// AllowWhitespaceOnly commits changes that only change whitespace
+	AllowWhitespaceOnly bool
+	// DiffStat prints the git diff --stat of the updated docs of each release
+	DiffStat bool
+	// CommitEmpty records an empty commit if the docs are up to date, see
+	// commitEmpty
+	CommitEmpty bool
+	// PostCommitHook is a shell command run after each commit, see
+	// runPostCommitHook
+	PostCommitHook string
+	HookRequired   bool
+	// RequireCleanAfter fails the run if the repo has any changes or
+	// untracked files once it's done
+	RequireCleanAfter bool
+	// NoReleaseTrailer omits the Release-Tag trailer from the commit message
+	NoReleaseTrailer bool
+	// CommitToRef is the ref the commit is written to with git plumbing,
+	// without a checkout, see commitToRef
+	CommitToRef string
+	// Clone is the URL of the repo to update in a fresh clone
+	Clone     string
+	KeepClone bool
+	Push      bool
+	// LocalBranch is the local branch remote-tracking release branches are
+	// checked out on
+	LocalBranch string
+	// VersionFile is written with the resolved patch version
+	VersionFile string
+	// Output is the format of the resolve command output
+	Output string
+	// ChangelogFile is prepended with the commits of the latest patch version
+	ChangelogFile string
+	// AttestationFile is written with an attestation of the commit, see
+	// writeAttestation
+	AttestationFile string
+	// ReportUnchanged lists the docs that were already current in the summary
+	ReportUnchanged bool
+	// ValidateURLs warns of the catalog URLs rewritten by the update that aren't
+	// reachable, see validateURLs
+	ValidateURLs bool
+	// FailOnWarnings fails the run once it's done if any warning was logged
+	FailOnWarnings bool
+	// ReportFile is the file the summary of the run is written to, see
+	// writeReport, and ReportOnlyFile omits the summary from stdout
+	ReportFile     string
+	ReportOnlyFile bool
+	// AssertNoStale fails if stale references remain after the commit
+	AssertNoStale bool
+	// CheckConsistency fails if the references of a doc disagree on the
+	// version after the update
+	CheckConsistency bool
+	ConfigFile       string
+	DumpConfig       bool
+	Color            string
+	Release          releaseOptions
+}
+
+// bulk reports whether the docs of several releases are updated on the current
+// checkout
+func (a arguments) bulk() bool {
+	return a.All || a.Manifest != "" || a.ChangedSince != "" || len(a.ReleaseBranches) > 1
 }
 
 // validate command line arguments
 func (a arguments) validate() error {
-	if a.ReleaseBranch == "" {
+	switch a.Command {
+	case cmdUpdate, cmdInit:
+	case cmdPreviewSeries:
+		if a.OutputDir == "" {
+			return fmt.Errorf("output dir not set")
+		}
+	case cmdVerifyAll, cmdStaleness:
+		return a.validateRelease()
+	case cmdAudit:
+		return nil
+	case cmdResolve:
+		if a.Output != outputText && a.Output != outputJSON {
+			return fmt.Errorf("expected %s or %s -output, got %q", outputText, outputJSON, a.Output)
+		}
+		if a.ReleaseBranch == "" {
+			return fmt.Errorf("release branch not set")
+		}
+		return a.validateRelease()
+	case cmdInspect:
+		if a.ReleaseBranch == "" {
+			return fmt.Errorf("release branch not set")
+		}
+		return a.validateRelease()
+	case cmdSchema:
+		if a.Schema != schemaMetadata && a.Schema != schemaConfig {
+			return fmt.Errorf("expected %s or %s schema, got %q", schemaMetadata, schemaConfig, a.Schema)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %s", a.Command)
+	}
+	if a.CommitStrategy != commitPerFunction && a.CommitStrategy != commitSingle {
+		return fmt.Errorf("invalid -commit-strategy: %s", a.CommitStrategy)
+	}
+	if a.bulk() {
+		if a.Command == cmdPreviewSeries {
+			return fmt.Errorf("bulk mode is not supported by %s", cmdPreviewSeries)
+		}
+		if a.Manifest != "" && (a.All || len(a.ReleaseBranches) > 0 || a.ReleaseBranch != "") {
+			return fmt.Errorf("-manifest is mutually exclusive with -all and release branches")
+		}
+		if a.ChangedSince != "" && (a.All || a.Manifest != "" || len(a.ReleaseBranches) > 0 || a.ReleaseBranch != "") {
+			return fmt.Errorf("-changed-since is mutually exclusive with -all, -manifest and release branches")
+		}
+		for flagName, set := range map[string]bool{
+			"checkout":           a.Checkout != "",
+			"from-tag":           a.FromTag != "",
+			"push":               a.Push,
+			"changelog-file":     a.ChangelogFile != "",
+			"write-version-file": a.VersionFile != "",
+			"commit-to-ref":      a.CommitToRef != "",
+			"target-version":     a.Release.TargetVersion != "",
+			"attestation-file":   a.AttestationFile != "",
+			"only-example":       a.Release.OnlyExample != "",
+			"commit-empty":       a.CommitEmpty,
+		} {
+			if set {
+				return fmt.Errorf("-%s is not supported in bulk mode", flagName)
+			}
+		}
+		return a.validateRelease()
+	}
+	if a.CommitToRef != "" {
+		if err := a.validateCommitToRef(); err != nil {
+			return err
+		}
+	}
+	if _, isTag := parseReleaseTag(a.ReleaseBranch); isTag && a.Release.TargetVersion != "" {
+		return fmt.Errorf("-target-version is not supported with a release tag, which is its own version")
+	}
+	if a.FromTag != "" {
+		if _, ok := parseReleaseTag(a.FromTag); !ok {
+			return fmt.Errorf("invalid -from-tag, expected a release tag: %s", a.FromTag)
+		}
+		if a.Command == cmdPreviewSeries {
+			return fmt.Errorf("-from-tag is not supported by %s", cmdPreviewSeries)
+		}
+		if a.Release.TargetVersion != "" {
+			return fmt.Errorf("-target-version and -from-tag are mutually exclusive")
+		}
+	} else if a.ReleaseBranch == "" {
 		return fmt.Errorf("release branch not set")
 	}
+	return a.validateRelease()
+}
+
+// validateCommitToRef validates the arguments of the -commit-to-ref mode, the
+// options working on the checkout or the working tree aren't supported
+func (a arguments) validateCommitToRef() error {
+	if !strings.HasPrefix(a.CommitToRef, "refs/") {
+		return fmt.Errorf("invalid -commit-to-ref, expected a full ref such as refs/heads/docs/update: %s",
+			a.CommitToRef)
+	}
+	if a.Command != cmdUpdate {
+		return fmt.Errorf("-commit-to-ref is not supported by %s", a.Command)
+	}
+	for flagName, set := range map[string]bool{
+		"checkout":         a.Checkout != "",
+		"from-tag":         a.FromTag != "",
+		"local-branch":     a.LocalBranch != "",
+		"no-commit":        a.NoCommit,
+		"push":             a.Push,
+		"changelog-file":   a.ChangelogFile != "",
+		"post-commit-hook": a.PostCommitHook != "",
+		"assert-no-stale":  a.AssertNoStale,
+		"commit-empty":     a.CommitEmpty,
+		"diffstat":         a.DiffStat,
+		"dry-run":          a.Release.DryRun,
+		"count-only":       a.Release.CountOnly,
+	} {
+		if set {
+			return fmt.Errorf("-%s is not supported with -commit-to-ref", flagName)
+		}
+	}
+	return nil
+}
+
+// validateRelease validates the arguments common to all modes
+func (a arguments) validateRelease() error {
+	if !validColorMode(a.Color) {
+		return fmt.Errorf("invalid -color: %s", a.Color)
+	}
+	if a.RequireCleanAfter && a.NoCommit {
+		return fmt.Errorf("-require-clean-after and -no-commit are mutually exclusive")
+	}
+	if a.ReportOnlyFile && a.ReportFile == "" {
+		return fmt.Errorf("-report-only-file requires -report-file")
+	}
+	if a.CommitEmpty && a.NoCommit {
+		return fmt.Errorf("-commit-empty and -no-commit are mutually exclusive")
+	}
+	if a.AttestationFile != "" && (a.NoCommit || a.Release.DryRun || a.Release.CountOnly) {
+		return fmt.Errorf("-attestation-file requires a commit, it's not supported with -no-commit, -dry-run or -count-only")
+	}
+	if a.Release.LsRemote && a.Release.Remote == "" {
+		return fmt.Errorf("remote not set for -ls-remote")
+	}
+	if a.Release.TagsFile != "" {
+		// the tags of the file may not exist in the repo
+		switch {
+		case a.Release.LsRemote:
+			return fmt.Errorf("-tags-file and -ls-remote are mutually exclusive")
+		case a.Release.RequireSignedTags:
+			return fmt.Errorf("-require-signed-tags is not supported with -tags-file")
+		case a.Release.SelectBy == selectByDate:
+			return fmt.Errorf("-select-by %s is not supported with -tags-file", selectByDate)
+		}
+	}
+	if a.Release.SelectBy != selectBySemver && a.Release.SelectBy != selectByDate {
+		return fmt.Errorf("invalid -select-by: %s", a.Release.SelectBy)
+	}
+	if a.Release.MinVersion != "" && !semver.IsValid(a.Release.MinVersion) {
+		return fmt.Errorf("invalid -min-version, expected a version such as v1.0.2: %s", a.Release.MinVersion)
+	}
+	// the function name and version are sanitized, only the prefix can make
+	// the branch name invalid
+	if err := checkBranchName(a.Release.BranchPrefix + "function-v0.0.0"); err != nil {
+		return fmt.Errorf("invalid -branch-prefix %q: %w", a.Release.BranchPrefix, err)
+	}
+	if a.Release.TargetVersion != "" && !semver.IsValid(a.Release.TargetVersion) {
+		return fmt.Errorf("invalid -target-version, expected a version such as v1.0.2: %s", a.Release.TargetVersion)
+	}
+	if a.Release.ForceLanguage != "" && !containsString(languages, a.Release.ForceLanguage) {
+		return fmt.Errorf("invalid -force-language, expected one of %s: %s",
+			strings.Join(languages, ", "), a.Release.ForceLanguage)
+	}
+	if a.Release.CombinedDiff && !a.Release.DryRun {
+		return fmt.Errorf("-combined-diff requires -dry-run")
+	}
+	if a.Release.DiffContext < 0 {
+		return fmt.Errorf("invalid -diff-context: %d", a.Release.DiffContext)
+	}
+	if a.Release.SkipFunctionDoc && a.Release.SkipExamples {
+		return fmt.Errorf("-skip-function-doc and -skip-examples leave no docs to update")
+	}
+	if a.Release.OnlyExample != "" && a.Release.SkipExamples {
+		return fmt.Errorf("-only-example and -skip-examples leave no docs to update")
+	}
+	switch a.Release.OnConflict {
+	case onConflictOverwrite, onConflictSkip, onConflictError:
+	default:
+		return fmt.Errorf("invalid -on-conflict: %s", a.Release.OnConflict)
+	}
+	switch a.Release.FunctionReadmeURLVersion {
+	case urlVersionMinor, urlVersionPatch:
+	default:
+		return fmt.Errorf("invalid -function-readme-url-version: %s", a.Release.FunctionReadmeURLVersion)
+	}
+	switch a.Release.TierRestrict {
+	case "", tierStable, tierContrib:
+	default:
+		return fmt.Errorf("invalid -tier-restrict: %s", a.Release.TierRestrict)
+	}
+	switch a.Release.ExamplesRequired {
+	case examplesRequiredNone, examplesRequiredAll, examplesRequiredStable:
+	default:
+		return fmt.Errorf("invalid -examples-required: %s", a.Release.ExamplesRequired)
+	}
+	if a.Release.RewritePackageHost != "" {
+		if _, _, ok := parsePackageHostRewrite(a.Release.RewritePackageHost); !ok {
+			return fmt.Errorf("invalid -rewrite-package-host, expected <old>=<new>: %s", a.Release.RewritePackageHost)
+		}
+	}
+	if a.Release.VersionVar != "" && !shellVarNamePattern.MatchString(a.Release.VersionVar) {
+		return fmt.Errorf("invalid -version-var, expected a shell variable name such as VERSION: %s", a.Release.VersionVar)
+	}
+	if name := a.Release.MetadataFilename; name != "" && (strings.ContainsAny(name, `/\`) || name == "." || name == "..") {
+		return fmt.Errorf("invalid -metadata-filename, expected a filename such as fn-meta.yaml: %s", name)
+	}
+	for _, pin := range a.Release.AlsoPin {
+		if _, _, ok := parseAlsoPin(pin); !ok {
+			return fmt.Errorf("invalid -also-pin, expected <function>=<version> such as set-labels=v0.1.5: %s", pin)
+		}
+	}
 	return nil
 }
 
 // parse command line arguments
 func parseArgs() (arguments, error) {
-	args := arguments{}
+	args := arguments{Command: cmdUpdate}
 	flag.StringVar(&args.ReleaseBranch, "branch", os.Getenv("RELEASE_BRANCH"),
 		"release branch (can also use RELEASE_BRANCH environment variable)")
+	flag.BoolVar(&args.All, "all", false,
+		"update the docs of the latest release of every function on the current checkout")
+	flag.StringVar(&args.Manifest, "manifest", "",
+		"YAML list of the releases to update the docs of in bulk mode, as function, language and minor entries")
+	flag.StringVar(&args.ChangedSince, "changed-since", "",
+		"ref to update the docs of the latest release of only the functions changed or released since in bulk mode, e.g. HEAD~1")
+	flag.StringVar(&args.CommitStrategy, "commit-strategy", commitPerFunction,
+		"commits in bulk mode: per-function, or single for one commit listing all functions")
+	flag.StringVar(&args.FromTag, "from-tag", "",
+		"release tag, e.g. go/apply-setters/v1.0.3, to update the docs of the current checkout for instead of a release branch")
+	flag.StringVar(&args.Checkout, "checkout", "",
+		"commit or tag of the release to check out instead of the release branch")
+	flag.StringVar(&args.LocalBranch, "local-branch", "",
+		"local branch to check out a remote-tracking release branch on (default the remote branch name)")
+	flag.BoolVar(&args.NoCommit, "no-commit", false,
+		"update the docs in the working tree without committing them")
+	flag.StringVar(&args.Clone, "clone", "",
+		"URL of the repo to clone into a temp directory and update there, leaving the current checkout untouched")
+	flag.BoolVar(&args.KeepClone, "keep-clone", false,
+		"keep the temp clone of -clone instead of removing it on exit")
+	flag.BoolVar(&args.Push, "push", false,
+		"push the commit to a <branch-prefix><function>-<version> branch of the remote")
+	flag.StringVar(&args.Release.BranchPrefix, "branch-prefix", defaultBranchPrefix,
+		"prefix of the branch name the commit is pushed to, or made on for detached checkouts, "+
+			"followed by <function>-<version>")
+	flag.StringVar(&args.ConfigFile, "config", "",
+		"YAML file of flag names to values, flags on the command line take precedence")
+	flag.BoolVar(&args.DumpConfig, "dump-config", false,
+		"print the effective configuration as YAML and exit")
+	flag.StringVar(&args.OutputDir, "output-dir", "",
+		"directory to render the READMEs to for preview-series")
+	flag.DurationVar(&args.Timeout, "timeout", 0,
+		"timeout after which git commands are killed, e.g. 5m (default no timeout)")
+	flag.StringVar(&args.LockFile, "lock-file", "",
+		"file created for the duration of the run so concurrent runs on the same checkout fail or wait, e.g. .git/update-docs.lock")
+	flag.DurationVar(&args.LockTimeout, "lock-timeout", 0,
+		"how long to wait for the -lock-file of another run to be released (default fail immediately)")
+	flag.StringVar(&args.CPUProfile, "cpuprofile", "",
+		"file to write a pprof CPU profile of the run to")
+	flag.StringVar(&args.MemProfile, "memprofile", "",
+		"file to write a pprof heap profile to at the end of the run")
+	flag.BoolVar(&args.NoVerify, "no-verify", false,
+		"skip the git hooks when committing")
+	flag.BoolVar(&args.AllowWhitespaceOnly, "allow-whitespace-only", false,
+		"commit the docs even if only whitespace changed")
+	flag.BoolVar(&args.DiffStat, "diffstat", false,
+		"print a git diff --stat of the docs updated, or that would be updated by -dry-run, for each release")
+	flag.BoolVar(&args.CommitEmpty, "commit-empty", false,
+		"record an empty commit marking the docs were checked if they're already up to date, instead of failing")
+	flag.StringVar(&args.PostCommitHook, "post-commit-hook", "",
+		"shell command run after each commit, with FUNCTION_NAME, LANGUAGE, MINOR_VERSION, LATEST_PATCH_VERSION, "+
+			"COMMIT_SHA and CHANGED_FILES (one per line, the release's docs with -commit-strategy single) in its environment")
+	flag.BoolVar(&args.HookRequired, "hook-required", false,
+		"fail the run if the -post-commit-hook exits non-zero, instead of warning")
+	flag.BoolVar(&args.RequireCleanAfter, "require-clean-after", false,
+		"fail if the repo has any changes or untracked files at the end of the run")
+	flag.BoolVar(&args.NoReleaseTrailer, "no-release-trailer", false,
+		"don't add a Release-Tag: <language>/<function>/<version> trailer to the commit message")
+	flag.StringVar(&args.CommitToRef, "commit-to-ref", "",
+		"full ref to write the commit to with git plumbing, e.g. refs/heads/docs/update, "+
+			"reading the docs from the release branch without a checkout or changing the working tree, also in bare repos")
+	flag.BoolVar(&args.QuietGit, "quiet-git", false,
+		"don't print the git commands or their output, errors still include git's stderr")
+	flag.BoolVar(&args.Unshallow, "unshallow", false,
+		"if the repo is a shallow clone, e.g. a CI checkout with fetch-depth: 1, fetch its full history and tags first")
+	flag.StringVar(&args.VersionFile, "write-version-file", "",
+		"file to write the resolved patch version to, as JSON with the function name and language if it ends in .json")
+	flag.StringVar(&args.Output, "output", outputText,
+		"format of the resolve output: text for the version only, or json with the function name and language")
+	flag.StringVar(&args.AttestationFile, "attestation-file", "",
+		"file to write an in-toto attestation of the commit to, with the tool version, release tag and hashes of the updated docs")
+	flag.StringVar(&args.ChangelogFile, "changelog-file", "",
+		"changelog to prepend an entry of the commits to the function since the previous patch version to")
+	flag.BoolVar(&args.Release.SkipExamples, "skip-examples", false,
+		"only update the function docs, leaving the example docs untouched")
+	flag.BoolVar(&args.Release.SkipFunctionDoc, "skip-function-doc", false,
+		"only update the example docs, leaving the function docs untouched")
+	flag.BoolVar(&args.Release.DryRun, "dry-run", false,
+		fmt.Sprintf("report the docs that would be updated without changing them, exiting %d if any would be. "+
+			"The docs are read from the release branch without checking it out or fetching, see -ls-remote for the latest tags",
+			exitDocsWouldChange))
+	flag.IntVar(&args.Release.DiffContext, "diff-context", defaultDiffContext,
+		"number of context lines of the diffs of the docs printed by -dry-run")
+	flag.BoolVar(&args.Release.CombinedDiff, "combined-diff", false,
+		"print the diffs of -dry-run as a single patch with git diff headers on stdout, for git apply, and the rest of the output on stderr")
+	flag.BoolVar(&args.Release.CountOnly, "count-only", false,
+		"print the totals of the references and the stale references in the docs without updating them")
+	flag.BoolVar(&args.ValidateURLs, "validate-urls", false,
+		"warn of the catalog URLs rewritten by the update that aren't reachable with a HEAD request, which requires network access")
+	flag.BoolVar(&args.FailOnWarnings, "fail-on-warnings", false,
+		fmt.Sprintf("exit non-zero once the run is done if any warning was logged, with 1 rather than %d for a -dry-run that would change docs",
+			exitDocsWouldChange))
+	flag.StringVar(&args.ReportFile, "report-file", "",
+		"file to also write the summary of the run to, as JSON if it ends in .json, markdown if it ends in .md, or else text")
+	flag.BoolVar(&args.ReportOnlyFile, "report-only-file", false,
+		"write the summary only to the -report-file, not stdout")
+	flag.BoolVar(&args.ReportUnchanged, "report-unchanged", false,
+		"also list the docs that were already current in the summary")
+	flag.BoolVar(&args.AssertNoStale, "assert-no-stale", false,
+		"fail if the committed docs still reference an older version of the function")
+	flag.BoolVar(&args.CheckConsistency, "check-consistency", false,
+		"fail before committing if a doc references several patch versions of the function, "+
+			"or catalog URLs of other minor versions")
+	flag.StringVar(&args.Color, "color", colorAuto,
+		"color the log output: auto (when writing to a terminal), always or never")
+	flag.BoolVar(&args.Release.LsRemote, "ls-remote", false,
+		"resolve the latest patch version from the remote tags without fetching them, "+
+			"the release branch is still fetched when it's checked out, i.e. without -from-tag, -dry-run or -commit-to-ref")
+	flag.StringVar(&args.Release.MinVersion, "min-version", "",
+		"lowest patch version to select, e.g. v1.0.2, failing if no tag is at or above it")
+	flag.StringVar(&args.Release.TargetVersion, "target-version", "",
+		"patch version to update the docs to, e.g. v1.0.2, even if it isn't tagged yet, to stage the docs of a release")
+	flag.StringVar(&args.Release.ForceLanguage, "force-language", "",
+		"language of the function directory the docs are read from, overriding the language of the tags, e.g. go")
+	flag.StringVar(&args.Release.SinceTag, "since-tag", "",
+		"prior release tag of the function, e.g. functions/go/apply-setters/v1.0.1, to use as the previous patch version "+
+			"and list the version transition of each doc since in the summary")
+	flag.StringVar(&args.Release.TagsFile, "tags-file", "",
+		"file of the tag names to resolve the latest patch version from, one per line, instead of the repo tags")
+	flag.StringVar(&args.Release.Remote, "remote", "origin",
+		"remote used to resolve tags with -ls-remote and to push to with -push")
+	flag.StringVar(&args.Release.Placeholder, "placeholder", "",
+		"version placeholder, e.g. __VERSION__, replaced with the latest patch version where it follows the function name")
+	flag.BoolVar(&args.Release.RequireSignedTags, "require-signed-tags", false,
+		"only consider tags with a valid signature, as verified by git tag -v")
+	flag.BoolVar(&args.Release.StrictTagFormat, "strict-tag-format", false,
+		"reject and warn about tags of the function that don't match <prefix>/<language>/<function>/v<major>.<minor>.<patch>")
+	flag.BoolVar(&args.Release.AllowFileVersion, "allow-file-version", false,
+		"use the function's VERSION file, or the info.version field of its Kptfile, when no matching tag is found")
+	flag.Var((*stringListFlag)(&args.Release.Registries), "registry",
+		fmt.Sprintf("registry mirroring the function images, can be repeated (always includes %s)",
+			strings.Join(defaultRegistries, ", ")))
+	flag.Var((*stringListFlag)(&args.Release.TranslationsDirs), "translations-dir",
+		"locale directory of translated docs to also update, e.g. docs/i18n/ja, can be repeated")
+	flag.StringVar(&args.Release.TransformerDir, "transformer-dir", "",
+		"directory of custom transformers run on each doc after the built-in replacements: "+
+			"*.tmpl Go templates of .Content, or executables reading the doc on stdin")
+	flag.Int64Var(&args.Release.MaxFileSize, "max-file-size", defaultMaxFileSize,
+		"size in bytes of the largest doc to update, larger docs are skipped with a warning (0 for no limit)")
+	flag.Var((*stringListFlag)(&args.Release.ExcludeExamples), "exclude-example",
+		"name of an example whose docs are left untouched, can be repeated")
+	flag.StringVar(&args.Release.OnlyExample, "only-example", "",
+		"name of the only example whose docs are updated, leaving the function docs and the other examples untouched")
+	flag.StringVar(&args.Release.FunctionReadmeURLVersion, "function-readme-url-version", urlVersionMinor,
+		"version the catalog URLs of the function README are pinned to: minor, or patch, the examples are pinned to minor")
+	flag.BoolVar(&args.Release.StripBOM, "strip-bom", false,
+		"remove a leading UTF-8 byte order mark from the updated docs instead of preserving it")
+	flag.BoolVar(&args.Release.MigrateContribPaths, "migrate-contrib-paths", false,
+		"rewrite the contrib/examples/<example> references of a function promoted to stable to examples/<example>")
+	flag.BoolVar(&args.Release.PreserveUnstableURLs, "preserve-unstable-urls", false,
+		"leave the catalog URLs of unstable, e.g. https://catalog.kpt.dev/apply-setters/unstable, untouched")
+	flag.BoolVar(&args.Release.TableUpdate, "table-update", false,
+		"also update the patch versions in markdown table rows with a cell of the function name, e.g. | apply-setters | v1.0.0 |")
+	flag.Var((*stringListFlag)(&args.Release.YAMLVersionLists), "yaml-version-lists",
+		"dotted key path of a version list in fenced yaml blocks, e.g. versions, whose latest entry of the release is bumped, can be repeated")
+	flag.StringVar(&args.Release.VersionVar, "version-var", "",
+		"shell variable, e.g. VERSION, whose patch version assignments in fenced shell blocks are updated, e.g. VERSION=v1.0.0")
+	flag.StringVar(&args.Release.ExampleURLPath, "example-url-path", "",
+		"path of the examples under the repo in the package URLs, e.g. samples (default examples, or contrib/examples for contrib functions)")
+	flag.StringVar(&args.Release.MetadataFilename, "metadata-filename", "",
+		"filename of the function metadata, e.g. fn-meta.yaml (default metadata.yaml, or metadata.json if only it exists)")
+	flag.StringVar(&args.Release.RewritePackageHost, "rewrite-package-host", "",
+		"<old>=<new> host and org to redirect the example package references to when pinning them, "+
+			"e.g. github.com/GoogleContainerTools=github.com/example for a fork")
+	flag.Var((*stringListFlag)(&args.Release.AlsoPin), "also-pin",
+		"<function>=<version> to also pin the package references of another function to, "+
+			"e.g. set-labels=v0.1.5 for examples cross-referencing it, can be repeated")
+	flag.StringVar(&args.Release.ExampleVersionsFile, "example-versions", "",
+		"YAML file of example names to the versions their package references are pinned to")
+	flag.StringVar(&args.Release.SelectBy, "select-by", selectBySemver,
+		"how the latest tag is selected: semver, or date for channels that don't follow semver, "+
+			"falling back to semver if a tag date is unavailable. Either way only <language>/<function>/v<major>.<minor>.<patch> "+
+			"release tags are candidates, date only changes which of them is the latest")
+	flag.StringVar(&args.Release.ExamplesRequired, "examples-required", examplesRequiredNone,
+		"which functions must have examples in their metadata, failing the update if not: "+
+			"none, all or stable (contrib functions may have none)")
+	flag.StringVar(&args.Release.TierRestrict, "tier-restrict", "",
+		"tier, stable or contrib, the functions must be in, failing on functions of the other tier (default any tier)")
+	flag.StringVar(&args.Release.OnConflict, "on-conflict", onConflictOverwrite,
+		"what to do with docs that reference versions other than the latest or previous patch, "+
+			"minor version or unstable: overwrite, skip (with a warning) or error")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [%s|%s] [flags] [<release_branch>...]\n"+
+				"       %s %s [flags] <function>/<minor_version>\n"+
+				"       %s %s [flags]\n"+
+				"       %s %s [flags]\n"+
+				"       %s %s [flags]\n"+
+				"       %s %s [flags] <release_branch>\n"+
+				"       %s %s [flags] <release_branch>\n"+
+				"       %s %s <%s|%s>\n",
+			os.Args[0], cmdUpdate, cmdInit, os.Args[0], cmdPreviewSeries, os.Args[0], cmdVerifyAll,
+			os.Args[0], cmdStaleness, os.Args[0], cmdAudit, os.Args[0], cmdResolve, os.Args[0], cmdInspect, os.Args[0], cmdSchema, schemaMetadata, schemaConfig)
+		flag.PrintDefaults()
+	}
 
-	flag.Parse()
+	cmdArgs := os.Args[1:]
+	if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+		args.Command = cmdArgs[0]
+		cmdArgs = cmdArgs[1:]
+	}
+	if err := flag.CommandLine.Parse(cmdArgs); err != nil {
+		return args, err
+	}
+	if args.Command == cmdSchema {
+		args.Schema = flag.Arg(0)
+	} else if flag.NArg() > 0 {
+		if err := flag.Set("branch", flag.Arg(0)); err != nil {
+			return args, err
+		}
+	}
+	if flag.NArg() > 1 {
+		args.ReleaseBranches = flag.Args()
+	}
+	if args.ConfigFile != "" {
+		if err := applyConfigFile(flag.CommandLine, args.ConfigFile); err != nil {
+			return args, err
+		}
+	}
+	if args.DumpConfig {
+		return args, nil
+	}
 
 	err := args.validate()
 	if err != nil {
@@ -60,40 +707,752 @@ func parseArgs() (arguments, error) {
 	return args, err
 }
 
-func main() {
+// updateRelease checks out the release branch, updates the docs and commits
+// the changes
+func updateRelease(args arguments) error {
+	dryRun := args.Release.DryRun
+	if !dryRun && !isCleanRepo() {
+		return fmt.Errorf("dirty repo")
+	}
+	// the release branch is only checked out without -from-tag, otherwise the
+	// tags are all that's needed, which -ls-remote and -tags-file resolve
+	// without a fetch. A dry run changes no refs, reading the local ones.
+	checkout := args.FromTag == ""
+	if !dryRun && (checkout || !args.Release.LsRemote && args.Release.TagsFile == "") {
+		if err := gitFetch(); err != nil {
+			return err
+		}
+	}
+	ref := args.ReleaseBranch
+	opts := args.Release
+	if !checkout {
+		// the docs of the current checkout are updated
+		ref = args.FromTag
+	} else {
+		target := args.ReleaseBranch
+		if args.Checkout != "" {
+			target = args.Checkout
+		}
+		if dryRun {
+			// the docs are read from the tree of the target, leaving the
+			// checkout as is
+			treeRef, err := resolveRelease(target)
+			if err != nil {
+				return err
+			}
+			opts.ReadTree = true
+			opts.TreeRef = treeRef
+		} else if gitCurrentBranch() == target {
+			infof("already on %s", target)
+		} else if err := checkoutRelease(target, args.LocalBranch); err != nil {
+			return err
+		}
+	}
+	fr, err := newFunctionRelease(ref, opts)
+	if err != nil {
+		return err
+	}
+	if args.VersionFile != "" {
+		if err = fr.writeVersionFile(args.VersionFile); err != nil {
+			return err
+		}
+	}
+	if err = updateFunctionDocs(args, fr); err != nil {
+		return err
+	}
+	if args.CheckConsistency {
+		if err = fr.checkConsistency(); err != nil {
+			return err
+		}
+	}
+	if args.ValidateURLs {
+		fr.validateURLs()
+	}
+	if args.Release.CountOnly {
+		fr.printCounts()
+		return nil
+	}
+	if err = summarize(args, fr); err != nil {
+		return err
+	}
+	if args.DiffStat {
+		if err = fr.printDiffStat(); err != nil {
+			return err
+		}
+	}
+	if args.Release.DryRun {
+		if err = printDiffs(args, fr); err != nil {
+			return err
+		}
+		if !fr.hasUpdates() {
+			return nil
+		}
+		if args.Push {
+			printPushPreview(args, fr)
+		}
+		return errDocsWouldChange
+	}
+	if isCleanRepo() {
+		if !args.CommitEmpty {
+			return fmt.Errorf("docs up to date")
+		}
+		if err = commitEmpty(args, fr); err != nil {
+			return err
+		}
+		if args.Push {
+			return gitPush(args.Release.Remote, fr.docsBranch())
+		}
+		return nil
+	}
+	if args.ChangelogFile != "" {
+		written, err := fr.writeChangelog(args.ChangelogFile)
+		if err != nil {
+			return err
+		}
+		if written && !args.NoCommit {
+			if err = gitAddFiles(args.ChangelogFile); err != nil {
+				return err
+			}
+		}
+	}
+	if args.NoCommit {
+		return nil
+	}
+	_, isTag := parseReleaseTag(ref)
+	if (isTag || args.Checkout != "") && gitIsDetached() {
+		// keep the commit reachable once the release branch is checked out
+		if err = gitCreateBranch(fr.docsBranch()); err != nil {
+			return err
+		}
+	}
+	if err = commitDocs(args, commitMessage(args, fr)); err != nil {
+		return err
+	}
+	if err = runPostCommitHook(args, fr); err != nil {
+		return err
+	}
+	if args.AttestationFile != "" {
+		commit, err := gitHeadCommit()
+		if err != nil {
+			return err
+		}
+		if err = fr.writeAttestation(args.AttestationFile, commit); err != nil {
+			return err
+		}
+	}
+	if args.AssertNoStale {
+		if err = fr.assertNoStale(); err != nil {
+			return err
+		}
+	}
+	if args.Push {
+		return gitPush(args.Release.Remote, fr.docsBranch())
+	}
+	return nil
+}
+
+// commitToRef updates the docs read from the tree of the release branch and
+// writes a commit of them on top of the branch to the ref, with a temporary
+// index so neither the working tree nor the repo's index are touched
+func commitToRef(args arguments) error {
+	if !args.Release.LsRemote && args.Release.TagsFile == "" {
+		if err := gitFetch(); err != nil {
+			return err
+		}
+	}
+	opts := args.Release
+	opts.ReadTree = true
+	fr, err := newFunctionRelease(args.ReleaseBranch, opts)
+	if err != nil {
+		return err
+	}
+	if args.VersionFile != "" {
+		if err = fr.writeVersionFile(args.VersionFile); err != nil {
+			return err
+		}
+	}
+	if err = updateFunctionDocs(args, fr); err != nil {
+		return err
+	}
+	if args.CheckConsistency {
+		if err = fr.checkConsistency(); err != nil {
+			return err
+		}
+	}
+	if args.ValidateURLs {
+		fr.validateURLs()
+	}
+	if err = summarize(args, fr); err != nil {
+		return err
+	}
+	if !fr.hasUpdates() {
+		return fmt.Errorf("docs up to date")
+	}
+	commit, err := fr.tree.commitDocs(fr.unwrittenDocs, commitMessage(args, fr))
+	if err != nil {
+		return err
+	}
+	if err = gitUpdateRef(args.CommitToRef, commit); err != nil {
+		return err
+	}
+	if args.AttestationFile != "" {
+		if err = fr.writeAttestation(args.AttestationFile, commit); err != nil {
+			return err
+		}
+	}
+	infof("committed %s to %s", commit, args.CommitToRef)
+	return nil
+}
+
+// printDiffs of the docs a dry run of the release would update, per doc or as
+// a combined patch
+func printDiffs(args arguments, fr *functionRelease) error {
+	if !args.Release.CombinedDiff {
+		return fr.previewDocs()
+	}
+	diff, err := fr.combinedDiff()
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+// printPushPreview prints the branch a dry run of the release would push, and
+// the title and body of a pull request of it to the release branch
+func printPushPreview(args arguments, fr *functionRelease) {
+	msg := commitMessage(args, fr)
+	title, body := msg, ""
+	if i := strings.Index(msg, "\n\n"); i >= 0 {
+		title, body = msg[:i], msg[i+2:]
+	}
+	fmt.Fprintf(levelInfo.out, "dry-run preview, nothing was pushed:\n"+
+		"remote: %s\nbase: %s\nhead: %s\ntitle: %s\nbody:\n%s\n",
+		args.Release.Remote, strings.TrimPrefix(args.ReleaseBranch, args.Release.Remote+"/"),
+		fr.docsBranch(), title, body)
+}
+
+// checkoutRelease checks out the target, on a local branch if it is a
+// remote-tracking branch so the commit can be pushed. The local branch is named
+// localBranch, or after the remote branch by default. A bare branch name
+// without a local branch is resolved to a remote-tracking branch, see
+// resolveBranch.
+func checkoutRelease(target, localBranch string) error {
+	resolved, err := resolveRelease(target)
+	if err != nil {
+		return err
+	}
+	remotes, err := gitRemotes()
+	if err != nil {
+		return err
+	}
+	branch, isRemote := remoteBranch(resolved, remotes)
+	if !isRemote {
+		return gitCheckout(resolved)
+	}
+	if resolved != target {
+		infof("resolved %s to %s", target, resolved)
+	}
+	if localBranch != "" {
+		branch = localBranch
+	}
+	return gitCheckoutLocal(branch, resolved)
+}
+
+// resolveRelease returns the ref checkoutRelease checks out for the target,
+// the target itself unless it's a bare branch name without a local branch,
+// see resolveBranch
+func resolveRelease(target string) (string, error) {
+	remotes, err := gitRemotes()
+	if err != nil {
+		return "", err
+	}
+	if _, isRemote := remoteBranch(target, remotes); isRemote {
+		return target, nil
+	}
+	resolved, err := resolveBranch(target, remotes)
+	if err != nil {
+		return "", fmt.Errorf("%w, pass the remote-tracking branch instead", err)
+	}
+	return resolved, nil
+}
+
+// updateReleases updates the docs of each release on the current checkout, and
+// commits them per function or in a single commit listing all the functions
+func updateReleases(args arguments) error {
+	refs := args.ReleaseBranches
+	// the manifest is validated before anything is changed
+	if args.Manifest != "" {
+		repoBase, err := (&functionRelease{opts: args.Release}).repoBase()
+		if err != nil {
+			return err
+		}
+		if refs, err = readManifest(args.Manifest, repoBase); err != nil {
+			return err
+		}
+	}
+	if !isCleanRepo() {
+		return fmt.Errorf("dirty repo")
+	}
+	if err := gitFetch(); err != nil {
+		return err
+	}
+	if args.All || args.ChangedSince != "" {
+		var err error
+		if refs, err = latestReleaseTags(args.Release); err != nil {
+			return err
+		}
+	}
+	if args.ChangedSince != "" {
+		var err error
+		if refs, err = changedReleaseTags(refs, args.ChangedSince); err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			infof("no functions changed since %s", args.ChangedSince)
+			return nil
+		}
+		infof("functions changed since %s: %s", args.ChangedSince, strings.Join(releaseFunctions(refs), ", "))
+	}
+
+	var summarized, audited, updated []*functionRelease
+	for _, ref := range refs {
+		fr, err := newFunctionRelease(ref, args.Release)
+		if err != nil {
+			if args.All || args.ChangedSince != "" {
+				// e.g. released functions that were since removed
+				warnf("skipping %s: %v", ref, err)
+				continue
+			}
+			return err
+		}
+		if err = updateFunctionDocs(args, fr); err != nil {
+			return err
+		}
+		if args.CheckConsistency {
+			if err = fr.checkConsistency(); err != nil {
+				return err
+			}
+		}
+		if args.ValidateURLs {
+			fr.validateURLs()
+		}
+		if args.Release.CountOnly {
+			fr.printCounts()
+			continue
+		}
+		if !args.ReportOnlyFile {
+			fr.printSummary(args.ReportUnchanged)
+		}
+		summarized = append(summarized, fr)
+		if args.DiffStat {
+			if err = fr.printDiffStat(); err != nil {
+				return err
+			}
+		}
+		if args.Release.DryRun {
+			if !args.Release.CombinedDiff {
+				if err = fr.previewDocs(); err != nil {
+					return err
+				}
+			}
+			audited = append(audited, fr)
+		}
+		if !fr.hasUpdates() {
+			continue
+		}
+		updated = append(updated, fr)
+		if args.NoCommit || args.Release.DryRun || args.CommitStrategy != commitPerFunction {
+			continue
+		}
+		if err = commitDocs(args, commitMessage(args, fr)); err != nil {
+			return err
+		}
+		if err = runPostCommitHook(args, fr); err != nil {
+			return err
+		}
+		if args.AssertNoStale {
+			if err = fr.assertNoStale(); err != nil {
+				return err
+			}
+		}
+	}
+	if args.Release.CountOnly {
+		return nil
+	}
+	if args.ReportFile != "" {
+		if err := writeReport(args.ReportFile, summarized, args.ReportUnchanged); err != nil {
+			return err
+		}
+	}
+	if args.Release.DryRun {
+		printDryRunReport(audited)
+		if args.Release.CombinedDiff {
+			for _, fr := range audited {
+				if err := printDiffs(args, fr); err != nil {
+					return err
+				}
+			}
+		}
+		if len(updated) > 0 {
+			return errDocsWouldChange
+		}
+		return nil
+	}
+	if len(updated) == 0 {
+		return fmt.Errorf("docs up to date")
+	}
+	if args.NoCommit || args.CommitStrategy == commitPerFunction {
+		return nil
+	}
+	msg := fmt.Sprintf("docs: Update tags for %d functions\n", len(updated))
+	for _, fr := range updated {
+		msg += fmt.Sprintf("\n- %s/%s/%s", fr.Language, fr.FunctionName, fr.LatestPatchVersion)
+	}
+	if !args.NoReleaseTrailer {
+		msg += "\n"
+		for _, fr := range updated {
+			msg += "\n" + releaseTrailer(fr)
+		}
+	}
+	if err := commitDocs(args, msg); err != nil {
+		return err
+	}
+	for _, fr := range updated {
+		if err := runPostCommitHook(args, fr); err != nil {
+			return err
+		}
+	}
+	if args.AssertNoStale {
+		for _, fr := range updated {
+			if err := fr.assertNoStale(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyAll checks the docs of the current checkout are pinned to the latest
+// release of every function, reporting the stale docs by function
+func verifyAll(args arguments) error {
+	if err := gitFetch(); err != nil {
+		return err
+	}
+	refs, err := latestReleaseTags(args.Release)
+	if err != nil {
+		return err
+	}
+	opts := args.Release
+	opts.CountOnly = true
+	verified, stale := 0, 0
+	for _, ref := range refs {
+		fr, err := newFunctionRelease(ref, opts)
+		if err != nil {
+			warnf("skipping %s: %v", ref, err)
+			continue
+		}
+		if err = fr.updateDocs(); err != nil {
+			return err
+		}
+		verified++
+		if fr.printStaleDocs() {
+			stale++
+		}
+	}
+	if stale > 0 {
+		return fmt.Errorf("docs of %d of %d functions are stale", stale, verified)
+	}
+	infof("docs of all %d functions are current", verified)
+	return nil
+}
+
+// summarize prints the summary of the release, unless -report-only-file is
+// set, and writes it to the -report-file
+func summarize(args arguments, fr *functionRelease) error {
+	if !args.ReportOnlyFile {
+		fr.printSummary(args.ReportUnchanged)
+	}
+	if args.ReportFile == "" {
+		return nil
+	}
+	return writeReport(args.ReportFile, []*functionRelease{fr}, args.ReportUnchanged)
+}
+
+// updateFunctionDocs runs the update or init command on the docs of the
+// release, once all of its docs are known to be updatable
+func updateFunctionDocs(args arguments, fr *functionRelease) error {
+	if err := fr.checkDocs(); err != nil {
+		return err
+	}
+	if args.Command == cmdInit {
+		return fr.initDocs()
+	}
+	return fr.updateDocs()
+}
+
+// commitMessage of the docs update of the release
+func commitMessage(args arguments, fr *functionRelease) string {
+	msg := fmt.Sprintf("docs: Update tags for %s/%s/%s",
+		fr.Language, fr.FunctionName, fr.LatestPatchVersion)
+	if !args.NoReleaseTrailer {
+		msg += "\n\n" + releaseTrailer(fr)
+	}
+	return msg
+}
+
+// releaseTrailer of the commit message, for finding the commits updating the
+// docs of a release, e.g. Release-Tag: go/apply-setters/v1.0.3
+func releaseTrailer(fr *functionRelease) string {
+	return fmt.Sprintf("Release-Tag: %s/%s/%s", fr.Language, fr.FunctionName, fr.LatestPatchVersion)
+}
+
+// commitDocs commits the updated docs
+func commitDocs(args arguments, msg string) error {
+	if err := gitAdd(); err != nil {
+		return err
+	}
+	// a commit of only whitespace normalization is noise
+	if !args.AllowWhitespaceOnly && isWhitespaceOnlyStaged() {
+		return fmt.Errorf("docs up to date, only whitespace changed (use -allow-whitespace-only to commit)")
+	}
+	var commitArgs []string
+	if args.NoVerify {
+		commitArgs = append(commitArgs, "--no-verify")
+	}
+	if err := gitCommit(msg, commitArgs...); err != nil {
+		return err
+	}
+	return gitShow()
+}
+
+// commitEmpty records an empty commit marking the docs of the release were
+// checked and already current
+func commitEmpty(args arguments, fr *functionRelease) error {
+	msg := fmt.Sprintf("docs: Docs already current for %s/%s", fr.FunctionName, fr.LatestPatchVersion)
+	if !args.NoReleaseTrailer {
+		msg += "\n\n" + releaseTrailer(fr)
+	}
+	commitArgs := []string{"--allow-empty"}
+	if args.NoVerify {
+		commitArgs = append(commitArgs, "--no-verify")
+	}
+	if err := gitCommit(msg, commitArgs...); err != nil {
+		return err
+	}
+	infof("docs already current for %s/%s, recorded an empty commit", fr.FunctionName, fr.LatestPatchVersion)
+	return nil
+}
+
+// cloneRepo clones the repo into a temp directory to run the update in, and
+// returns a function that restores the working directory and removes the
+// clone unless it is kept
+func cloneRepo(args *arguments) (func(), error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "update_function_docs-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		if err := os.Chdir(wd); err != nil {
+			warnf("%v", err)
+		}
+		if args.KeepClone {
+			infof("kept clone in %s", dir)
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			warnf("failed to remove clone: %v", err)
+		}
+	}
+	if err = gitClone(args.Clone, dir); err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err = os.Chdir(dir); err != nil {
+		cleanup()
+		return nil, err
+	}
+	args.Release.RepoDir = dir
+	return cleanup, nil
+}
+
+// run the command, in a fresh clone if one is set
+func run(args arguments) error {
+	if args.Clone != "" {
+		cleanup, err := cloneRepo(&args)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	if args.Unshallow && gitIsShallow() {
+		if err := gitUnshallow(); err != nil {
+			return err
+		}
+	}
 	var err error
+	switch {
+	case args.Command == cmdPreviewSeries:
+		err = previewSeries(args)
+	case args.Command == cmdVerifyAll:
+		err = verifyAll(args)
+	case args.Command == cmdStaleness:
+		err = staleness(args)
+	case args.Command == cmdAudit:
+		err = audit()
+	case args.Command == cmdResolve:
+		err = resolve(args)
+	case args.Command == cmdInspect:
+		err = inspect(args)
+	case args.CommitToRef != "":
+		err = commitToRef(args)
+	case args.bulk():
+		err = updateReleases(args)
+	default:
+		err = updateRelease(args)
+	}
+	if err != nil || !args.RequireCleanAfter {
+		return err
+	}
+	// catches side effects such as backup or temp files left in the repo
+	status, err := gitStatusPorcelain()
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return fmt.Errorf("repo not clean after the update:\n%s", status)
+	}
+	return nil
+}
+
+// resolve prints the latest patch version of the release, without checking
+// out the release branch or reading its docs
+func resolve(args arguments) error {
+	if !args.Release.LsRemote && args.Release.TagsFile == "" {
+		if err := gitFetch(); err != nil {
+			return err
+		}
+	}
+	fr := &functionRelease{opts: args.Release}
+	if err := fr.setReleaseBranch(args.ReleaseBranch); err != nil {
+		return err
+	}
+	if err := fr.readLatestPatchVersion(); err != nil {
+		return err
+	}
+	contents, err := fr.resolvedVersion(args.Output == outputJSON)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(contents)
+	return err
+}
+
+// inspect prints the function release as JSON, read from the tree of the
+// release branch without checking it out
+func inspect(args arguments) error {
+	if !args.Release.LsRemote && args.Release.TagsFile == "" {
+		if err := gitFetch(); err != nil {
+			return err
+		}
+	}
+	opts := args.Release
+	opts.ReadTree = true
+	fr, err := newFunctionRelease(args.ReleaseBranch, opts)
+	if err != nil {
+		return err
+	}
+	contents, err := fr.inspection()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(contents)
+	return err
+}
+
+// previewSeries renders the function README of the current checkout for each
+// patch version of the release
+func previewSeries(args arguments) error {
+	if err := gitFetch(); err != nil {
+		return err
+	}
+	fr, err := newFunctionRelease(args.ReleaseBranch, args.Release)
+	if err != nil {
+		return err
+	}
+	return fr.previewSeries(args.OutputDir)
+}
+
+func main() {
 	args, err := parseArgs()
 	if err != nil {
 		exitWithErr(err)
 	}
-	if !isCleanRepo() {
-		exitWithErr(fmt.Errorf("dirty repo"))
+	if args.DumpConfig {
+		if err = dumpConfig(flag.CommandLine, os.Stdout); err != nil {
+			exitWithErr(err)
+		}
+		return
 	}
-	if err = gitFetch(); err != nil {
-		exitWithErr(err)
+	if args.Command == cmdSchema {
+		if err = writeSchema(args.Schema, flag.CommandLine, os.Stdout); err != nil {
+			exitWithErr(err)
+		}
+		return
 	}
-	if err = gitCheckout(args.ReleaseBranch); err != nil {
-		exitWithErr(err)
+	colorMode = args.Color
+	// leave stdout to the -combined-diff patch, so it can be piped to git apply
+	if args.Release.CombinedDiff {
+		levelInfo.out = os.Stderr
+	}
+	// the output of resolve and inspect is for scripts to capture
+	quietGit = args.QuietGit || args.Command == cmdResolve || args.Command == cmdInspect
+	if args.Timeout > 0 {
+		var cancel context.CancelFunc
+		cmdContext, cancel = context.WithTimeout(context.Background(), args.Timeout)
+		defer cancel()
 	}
-	fr, err := newFunctionRelease(args.ReleaseBranch)
+	// SIGINT or SIGTERM kill the running command and fail the later ones, so
+	// run returns and the clone is removed, the profiles are written and the
+	// lock file is released as on any other error
+	signalContext, stopSignals := signal.NotifyContext(cmdContext, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	cmdContext = signalContext
+	release, err := acquireLock(signalContext, args.LockFile, args.LockTimeout)
 	if err != nil {
+		if errors.Is(signalContext.Err(), context.Canceled) {
+			err = errInterrupted
+		}
 		exitWithErr(err)
 	}
-	if err = fr.updateDocs(); err != nil {
+	stopProfiles, err := startProfiles(args.CPUProfile, args.MemProfile)
+	if err != nil {
+		release()
 		exitWithErr(err)
 	}
-	if isCleanRepo() {
-		exitWithErr(fmt.Errorf("docs up to date"))
+	err = run(args)
+	// stopped and released before exiting, which skips deferred calls
+	if profileErr := stopProfiles(); profileErr != nil {
+		warnf("%v", profileErr)
 	}
-	if err = gitAdd(); err != nil {
-		exitWithErr(err)
+	release()
+	if errors.Is(signalContext.Err(), context.Canceled) {
+		err = errInterrupted
 	}
-	msg := fmt.Sprintf("docs: Update tags for %s/%s/%s",
-		fr.Language, fr.FunctionName, fr.LatestPatchVersion)
-	if err = gitCommit(msg); err != nil {
-		exitWithErr(err)
+	// the warnings fail a dry run that would change docs too, rather than
+	// being hidden by its exit code
+	if (err == nil || errors.Is(err, errDocsWouldChange)) && args.FailOnWarnings && warningCount > 0 {
+		err = fmt.Errorf("%d warnings logged with -fail-on-warnings", warningCount)
 	}
-	if err = gitShow(); err != nil {
+	if err != nil {
+		if errors.Is(err, errDocsWouldChange) {
+			infof("%v", err)
+			os.Exit(exitDocsWouldChange)
+		}
 		exitWithErr(err)
 	}
 }
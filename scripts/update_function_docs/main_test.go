@@ -0,0 +1,842 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runGit runs git in dir and fails the test on error
+func runGit(t *testing.T, dir string, arg ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", arg...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(arg, " "), err, out)
+	}
+	return string(out)
+}
+
+// writeFiles writes the files, keyed by slash separated path, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+// setupGitEnv isolates git from the user's configuration
+func setupGitEnv(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+}
+
+// setupReleaseRepo creates an origin repo with a foo function released as
+// functions/go/foo/v0.1.0 and v0.1.1 on the foo/v0.1 branch, and returns a
+// clone of it
+func setupReleaseRepo(t *testing.T) string {
+	t.Helper()
+	setupGitEnv(t)
+	tmp := t.TempDir()
+	origin := filepath.Join(tmp, "origin.git")
+	work := filepath.Join(tmp, "work")
+	clone := filepath.Join(tmp, "clone")
+	runGit(t, tmp, "init", "-q", "--bare", "--initial-branch=main", origin)
+	runGit(t, tmp, "init", "-q", work)
+	writeFiles(t, work, map[string]string{
+		"functions/go/foo/README.md": "# foo\n\n" +
+			"$ kpt fn eval --image gcr.io/kpt-fn/foo:unstable\n\n" +
+			"See https://catalog.kpt.dev/foo/v0.1/\n",
+		"functions/go/foo/metadata.yaml": "image: gcr.io/kpt-fn/foo\n" +
+			"examplePackageURLs:\n" +
+			"  - https://github.com/GoogleContainerTools/kpt-functions-catalog/tree/master/examples/foo-simple\n",
+		"examples/foo-simple/README.md": "# foo: Simple Example\n\n" +
+			"$ kpt pkg get https://github.com/GoogleContainerTools/kpt-functions-catalog.git/examples/foo-simple\n",
+	})
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "-q", "-m", "add foo")
+	runGit(t, work, "branch", "foo/v0.1")
+	runGit(t, work, "tag", "functions/go/foo/v0.1.0")
+	runGit(t, work, "tag", "functions/go/foo/v0.1.1")
+	runGit(t, work, "push", "-q", "--tags", origin, "foo/v0.1", "HEAD:refs/heads/main")
+	runGit(t, tmp, "clone", "-q", origin, clone)
+	return clone
+}
+
+// buildTool builds the tool where it lives in the repo so the doc paths
+// resolve relative to the repo
+func buildTool(t *testing.T, repo string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping build of update_function_docs in short mode")
+	}
+	tool := filepath.Join(repo, "scripts", "update_function_docs", "update_function_docs")
+	cmd := exec.Command("go", "build", "-o", tool, ".")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return tool
+}
+
+// runTool runs the tool in the repo and returns its combined output
+func runTool(t *testing.T, tool, repo string, arg ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(tool, arg...)
+	cmd.Dir = repo
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestMainUpdatesAndCommitsDocs(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-assert-no-stale")
+	if err != nil {
+		t.Fatalf("first run failed: %v\n%s", err, out)
+	}
+	msg := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%s"))
+	if expected := "docs: Update tags for go/foo/v0.1.1"; msg != expected {
+		t.Errorf("expected commit message %q, got %q", expected, msg)
+	}
+	trailer := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%(trailers:key=Release-Tag,valueonly)"))
+	if expected := "go/foo/v0.1.1"; trailer != expected {
+		t.Errorf("expected Release-Tag trailer %q, got %q", expected, trailer)
+	}
+	// the remote-tracking branch is checked out on a local branch
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "foo/v0.1" {
+		t.Errorf("expected the commit on the local foo/v0.1 branch, got %s", branch)
+	}
+	readme := readFile(t, filepath.Join(repo, "functions", "go", "foo", "README.md"))
+	if !strings.Contains(readme, "gcr.io/kpt-fn/foo:v0.1.1") {
+		t.Errorf("function README not pinned to v0.1.1:\n%s", readme)
+	}
+	exampleReadme := readFile(t, filepath.Join(repo, "examples", "foo-simple", "README.md"))
+	if !strings.Contains(exampleReadme, "examples/foo-simple@foo/v0.1.1\n") {
+		t.Errorf("example README not pinned to v0.1.1:\n%s", exampleReadme)
+	}
+
+	// pushing the commit is left to the user
+	runGit(t, repo, "push", "-q", "origin", "HEAD:refs/heads/foo/v0.1")
+	out, err = runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-report-unchanged")
+	if err == nil {
+		t.Fatalf("expected second run to fail with up to date docs\n%s", out)
+	}
+	if !strings.Contains(out, "docs up to date") {
+		t.Errorf("expected up to date docs, got:\n%s", out)
+	}
+	if !strings.Contains(out, "already current:") ||
+		!strings.Contains(out, filepath.Join("examples", "foo-simple", "README.md")) {
+		t.Errorf("expected the already current docs to be listed, got:\n%s", out)
+	}
+}
+
+func TestMainLocalBranch(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-local-branch", "docs/foo")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "docs/foo" {
+		t.Errorf("expected the commit on docs/foo, got %s", branch)
+	}
+	if upstream := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "@{upstream}")); upstream != "origin/foo/v0.1" {
+		t.Errorf("expected docs/foo to track origin/foo/v0.1, got %s", upstream)
+	}
+}
+
+func TestMainReleaseTag(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	readmePath := filepath.Join(repo, "functions", "go", "foo", "README.md")
+
+	out, err := runTool(t, tool, repo, "-branch", "functions/go/foo/v0.1.0", "-no-commit")
+	if err != nil {
+		t.Fatalf("-no-commit run failed: %v\n%s", err, out)
+	}
+	if readme := readFile(t, readmePath); !strings.Contains(readme, "gcr.io/kpt-fn/foo:v0.1.0") {
+		t.Errorf("function README not pinned to v0.1.0:\n%s", readme)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status == "" {
+		t.Errorf("expected the docs to be left uncommitted")
+	}
+	runGit(t, repo, "checkout", "-q", "--", ".")
+
+	out, err = runTool(t, tool, repo, "-branch", "functions/go/foo/v0.1.0")
+	if err != nil {
+		t.Fatalf("tag run failed: %v\n%s", err, out)
+	}
+	branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD"))
+	if expected := "docs/update-foo-v0.1.0"; branch != expected {
+		t.Errorf("expected the commit on branch %q, got %q", expected, branch)
+	}
+	msg := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%s"))
+	if expected := "docs: Update tags for go/foo/v0.1.0"; msg != expected {
+		t.Errorf("expected commit message %q, got %q", expected, msg)
+	}
+}
+
+func TestMainQuietGit(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-quiet-git")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	for _, noise := range []string{"git fetch", "diff --git"} {
+		if strings.Contains(out, noise) {
+			t.Errorf("expected no %q in the output, got:\n%s", noise, out)
+		}
+	}
+	if !strings.Contains(out, "updated 3 of 3 docs") {
+		t.Errorf("expected the summary in the output, got:\n%s", out)
+	}
+}
+
+func TestMainCloneAndPush(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	origin := filepath.Join(filepath.Dir(repo), "origin.git")
+	head := runGit(t, repo, "rev-parse", "HEAD")
+
+	out, err := runTool(t, tool, repo, "-clone", origin, "-push", "-branch", "origin/foo/v0.1")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	msg := strings.TrimSpace(runGit(t, origin, "log", "-1", "--format=%s", "docs/update-foo-v0.1.1"))
+	if expected := "docs: Update tags for go/foo/v0.1.1"; msg != expected {
+		t.Errorf("expected pushed commit message %q, got %q", expected, msg)
+	}
+	if actual := runGit(t, repo, "rev-parse", "HEAD"); actual != head {
+		t.Errorf("expected the checkout to be untouched, HEAD moved from %s to %s", head, actual)
+	}
+	if readme := readFile(t, filepath.Join(repo, "functions", "go", "foo", "README.md")); strings.Contains(readme, "v0.1.1") {
+		t.Errorf("expected the checkout's README to be untouched:\n%s", readme)
+	}
+}
+
+func TestMainInterruptCleansUp(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	origin := filepath.Join(filepath.Dir(repo), "origin.git")
+	lockFile := filepath.Join(t.TempDir(), "update-docs.lock")
+	hookDir := filepath.Join(t.TempDir(), "hook-dir")
+
+	// the hook records the clone it runs in and hangs until interrupted
+	cmd := exec.Command(tool, "-lock-file", lockFile, "-clone", origin, "-branch", "origin/foo/v0.1",
+		"-post-commit-hook", fmt.Sprintf("pwd > %s.tmp && mv %s.tmp %s && sleep 30", hookDir, hookDir, hookDir))
+	cmd.Dir = repo
+	var out strings.Builder
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for !fileExists(hookDir) {
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			t.Fatalf("timed out waiting for the hook:\n%s", out.String())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "interrupted by a signal") {
+		t.Errorf("expected the interruption to be reported, got:\n%s", out.String())
+	}
+	if fileExists(lockFile) {
+		t.Error("expected the lock file to be released")
+	}
+	if clone := strings.TrimSpace(readFile(t, hookDir)); fileExists(clone) {
+		t.Errorf("expected the clone %s to be removed", clone)
+	}
+}
+
+func TestMainCountOnly(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-count-only", "-branch", "origin/foo/v0.1")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if expected := "foo/v0.1.1: 4 references in 3 docs, 3 stale references in 3 docs"; !strings.Contains(out, expected) {
+		t.Errorf("expected %q in the output, got:\n%s", expected, out)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+}
+
+func TestMainAlreadyOnBranch(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	runGit(t, repo, "checkout", "-q", "foo/v0.1")
+
+	out, err := runTool(t, tool, repo, "-branch", "foo/v0.1")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "already on foo/v0.1") {
+		t.Errorf("expected the branch to be reported current, got:\n%s", out)
+	}
+	if strings.Contains(out, "git checkout") {
+		t.Errorf("expected no checkout, got:\n%s", out)
+	}
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "foo/v0.1" {
+		t.Errorf("expected to stay on foo/v0.1, got %s", branch)
+	}
+}
+
+func TestMainCommitEmpty(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-branch", "origin/foo/v0.1")
+	if err != nil {
+		t.Fatalf("first run failed: %v\n%s", err, out)
+	}
+	runGit(t, repo, "push", "-q", "origin", "HEAD:refs/heads/foo/v0.1")
+	updated := runGit(t, repo, "rev-parse", "HEAD")
+
+	out, err = runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-commit-empty")
+	if err != nil {
+		t.Fatalf("run with up to date docs failed: %v\n%s", err, out)
+	}
+	msg := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%s"))
+	if expected := "docs: Docs already current for foo/v0.1.1"; msg != expected {
+		t.Errorf("expected commit message %q, got %q", expected, msg)
+	}
+	if parent := runGit(t, repo, "rev-parse", "HEAD~1"); parent != updated {
+		t.Errorf("expected the marker on top of the update commit %s, got %s", updated, parent)
+	}
+	if files := runGit(t, repo, "show", "--format=", "--name-only", "HEAD"); files != "" {
+		t.Errorf("expected an empty commit, got changes to:\n%s", files)
+	}
+}
+
+func TestMainDiffStat(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	runGit(t, repo, "checkout", "-q", "foo/v0.1")
+
+	out, err := runTool(t, tool, repo, "-branch", "foo/v0.1", "-dry-run", "-diffstat", "-quiet-git")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitDocsWouldChange {
+		t.Fatalf("expected exit code %d, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+	dryRunStat := diffStatLines(out)
+	if len(dryRunStat) == 0 {
+		t.Fatalf("expected a diffstat in the dry run output, got:\n%s", out)
+	}
+
+	out, err = runTool(t, tool, repo, "-branch", "foo/v0.1", "-no-commit", "-diffstat", "-quiet-git")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	// the dry run diffstat is computed as git computes the diffstat of the
+	// written docs
+	if stat := diffStatLines(out); !reflect.DeepEqual(stat, dryRunStat) {
+		t.Errorf("expected the diffstat %q, got %q", dryRunStat, stat)
+	}
+}
+
+// diffStatLines returns the lines of the diffstat in the output
+func diffStatLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, " | ") || strings.Contains(line, " changed, ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestMainFromTag(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-from-tag", "go/foo/v0.1.1")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "git checkout") {
+		t.Errorf("expected the current checkout to be updated, got:\n%s", out)
+	}
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "main" {
+		t.Errorf("expected the commit on main, got %s", branch)
+	}
+	msg := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%s"))
+	if expected := "docs: Update tags for go/foo/v0.1.1"; msg != expected {
+		t.Errorf("expected commit message %q, got %q", expected, msg)
+	}
+
+	out, err = runTool(t, tool, repo, "-from-tag", "foo/v0.1")
+	if err == nil || !strings.Contains(out, "invalid -from-tag") {
+		t.Errorf("expected an invalid tag error, got %v:\n%s", err, out)
+	}
+}
+
+func TestMainFromTagLsRemote(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	// the tags are resolved from the remote, without a checkout there's
+	// nothing to fetch
+	out, err := runTool(t, tool, repo, "-ls-remote", "-from-tag", "go/foo/v0.1.1")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "git fetch") || !strings.Contains(out, "git ls-remote") {
+		t.Errorf("expected the tags to be resolved without a fetch, got:\n%s", out)
+	}
+}
+
+// addBarRelease adds a bar function released as functions/go/bar/v0.2.0 to the
+// repo
+func addBarRelease(t *testing.T, repo string) {
+	t.Helper()
+	writeFiles(t, repo, map[string]string{
+		"functions/go/bar/README.md":     "# bar\n\n$ kpt fn eval --image gcr.io/kpt-fn/bar:unstable\n",
+		"functions/go/bar/metadata.yaml": "image: gcr.io/kpt-fn/bar\n",
+	})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "add bar")
+	runGit(t, repo, "tag", "functions/go/bar/v0.2.0")
+}
+
+func TestMainBulk(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      []string
+		expected []string
+	}{
+		{
+			name: "per function commits",
+			arg:  []string{"update", "foo/v0.1", "functions/go/bar/v0.2.0"},
+			expected: []string{
+				"docs: Update tags for go/bar/v0.2.0\n\nRelease-Tag: go/bar/v0.2.0",
+				"docs: Update tags for go/foo/v0.1.1\n\nRelease-Tag: go/foo/v0.1.1",
+			},
+		},
+		{
+			name: "single commit of all functions",
+			arg:  []string{"-all", "-commit-strategy", "single"},
+			expected: []string{
+				"docs: Update tags for 2 functions\n\n- go/bar/v0.2.0\n- go/foo/v0.1.1\n\n" +
+					"Release-Tag: go/bar/v0.2.0\nRelease-Tag: go/foo/v0.1.1",
+			},
+		},
+		{
+			name: "no release trailer",
+			arg:  []string{"-all", "-commit-strategy", "single", "-no-release-trailer"},
+			expected: []string{
+				"docs: Update tags for 2 functions\n\n- go/bar/v0.2.0\n- go/foo/v0.1.1",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := setupReleaseRepo(t)
+			tool := buildTool(t, repo)
+			addBarRelease(t, repo)
+
+			out, err := runTool(t, tool, repo, tc.arg...)
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, out)
+			}
+			if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "main" {
+				t.Errorf("expected the commits on main, got %s", branch)
+			}
+			log := runGit(t, repo, "log", fmt.Sprintf("-%d", len(tc.expected)), "--format=%B%x00")
+			var actual []string
+			for _, msg := range strings.Split(log, "\x00") {
+				if msg = strings.TrimSpace(msg); msg != "" {
+					actual = append(actual, msg)
+				}
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected commits %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMainChangedSince(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	addBarRelease(t, repo)
+
+	out, err := runTool(t, tool, repo, "-changed-since", "HEAD~1")
+	if err != nil {
+		t.Fatalf("update failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "functions changed since HEAD~1: go/bar\n") {
+		t.Errorf("expected only bar to have changed, got:\n%s", out)
+	}
+	if log := strings.TrimSpace(runGit(t, repo, "log", "-1", "--format=%s")); log != "docs: Update tags for go/bar/v0.2.0" {
+		t.Errorf("expected the docs of bar to be committed, got %s", log)
+	}
+
+	if out, err = runTool(t, tool, repo, "-changed-since", "HEAD"); err != nil {
+		t.Fatalf("expected no changed functions to succeed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "no functions changed since HEAD") {
+		t.Errorf("expected no changed functions, got:\n%s", out)
+	}
+}
+
+func TestMainCombinedDiff(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	// the patch must mark the doc's last line without a newline to apply
+	readme := filepath.Join(repo, "functions", "go", "foo", "README.md")
+	writeFiles(t, repo, map[string]string{"functions/go/foo/README.md": strings.TrimSuffix(readFile(t, readme), "\n")})
+	runGit(t, repo, "commit", "-q", "-a", "-m", "drop the last newline")
+	runGit(t, repo, "push", "-q", "origin", "HEAD:foo/v0.1")
+
+	cmd := exec.Command(tool, "-dry-run", "-combined-diff", "-branch", "origin/foo/v0.1")
+	cmd.Dir = repo
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, _ := cmd.Output()
+	out := string(stdout)
+	if !strings.HasPrefix(out, "diff --git a/functions/go/foo/README.md b/functions/go/foo/README.md\n") {
+		t.Fatalf("expected only a combined diff with paths relative to the repo on stdout, got:\n%s\nstderr:\n%s", out, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "would update 3 of 3 docs") {
+		t.Errorf("expected the report on stderr, got:\n%s", stderr.String())
+	}
+	patch := filepath.Join(t.TempDir(), "docs.patch")
+	writeFiles(t, filepath.Dir(patch), map[string]string{"docs.patch": out})
+	runGit(t, repo, "apply", "--check", patch)
+	runGit(t, repo, "apply", "--index", patch)
+	runGit(t, repo, "commit", "-q", "-m", "apply the combined diff")
+	if out, err := runTool(t, tool, repo, "-dry-run", "-from-tag", "go/foo/v0.1.1"); err != nil {
+		t.Errorf("expected the applied patch to leave no stale docs: %v\n%s", err, out)
+	}
+}
+
+func TestMainFailOnWarnings(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	// the dry run would change docs and warns of the unknown example
+	args := []string{"-dry-run", "-branch", "origin/foo/v0.1", "-exclude-example", "missing"}
+	out, err := runTool(t, tool, repo, args...)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitDocsWouldChange {
+		t.Fatalf("expected exit code %d, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+	out, err = runTool(t, tool, repo, append(args, "-fail-on-warnings")...)
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 || !strings.Contains(out, "1 warnings logged with -fail-on-warnings") {
+		t.Errorf("expected the warnings to fail the run over exit code %d, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+}
+
+func TestMainBulkDryRun(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	addBarRelease(t, repo)
+	head := runGit(t, repo, "rev-parse", "HEAD")
+
+	out, err := runTool(t, tool, repo, "-all", "-dry-run")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitDocsWouldChange {
+		t.Fatalf("expected exit code %d, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+	var rows []string
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 7 && strings.HasPrefix(fields[0], "go/") {
+			rows = append(rows, strings.Join(fields, " "))
+		}
+	}
+	expected := []string{"go/bar v0.2.0 yes 2 1 1 1", "go/foo v0.1.1 yes 3 3 4 3"}
+	if !reflect.DeepEqual(expected, rows) {
+		t.Errorf("expected report rows %q, got %q\n%s", expected, rows, out)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+	if actual := runGit(t, repo, "rev-parse", "HEAD"); actual != head {
+		t.Errorf("expected HEAD to stay at %s, got %s", head, actual)
+	}
+}
+
+func TestMainRequireCleanAfter(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	// the tool built in the repo is ignored, as by the repo's .gitignore
+	writeFiles(t, repo, map[string]string{".git/info/exclude": "/scripts/update_function_docs/update_function_docs\n"})
+
+	// a side effect leaving an untracked file fails the run
+	out, err := runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-require-clean-after",
+		"-post-commit-hook", "touch README.md.bak")
+	if err == nil || !strings.Contains(out, "repo not clean after the update") || !strings.Contains(out, "?? README.md.bak") {
+		t.Fatalf("expected the stray file to fail the run, got %v\n%s", err, out)
+	}
+	runGit(t, repo, "clean", "-q", "-f")
+	runGit(t, repo, "reset", "-q", "--hard", "HEAD~1")
+
+	if out, err = runTool(t, tool, repo, "-branch", "origin/foo/v0.1", "-require-clean-after"); err != nil {
+		t.Errorf("expected a clean run to pass: %v\n%s", err, out)
+	}
+}
+
+func TestMainCommitToRef(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	bare := filepath.Join(filepath.Dir(repo), "bare.git")
+	runGit(t, filepath.Dir(repo), "clone", "-q", "--bare", filepath.Join(filepath.Dir(repo), "origin.git"), bare)
+
+	out, err := runTool(t, tool, bare, "-commit-to-ref", "refs/heads/docs/update-foo", "foo/v0.1")
+	if err != nil {
+		t.Fatalf("commit to ref failed: %v\n%s", err, out)
+	}
+	if parent := runGit(t, bare, "rev-parse", "docs/update-foo^"); parent != runGit(t, bare, "rev-parse", "foo/v0.1") {
+		t.Errorf("expected the commit on top of the release branch, got parent %s", parent)
+	}
+	if subject := strings.TrimSpace(runGit(t, bare, "log", "-1", "--format=%s", "docs/update-foo")); subject != "docs: Update tags for go/foo/v0.1.1" {
+		t.Errorf("unexpected commit subject: %s", subject)
+	}
+	readme := runGit(t, bare, "show", "docs/update-foo:functions/go/foo/README.md")
+	if !strings.Contains(readme, "gcr.io/kpt-fn/foo:v0.1.1") {
+		t.Errorf("expected the committed README to be pinned to v0.1.1, got:\n%s", readme)
+	}
+	example := runGit(t, bare, "show", "docs/update-foo:examples/foo-simple/README.md")
+	if !strings.Contains(example, "examples/foo-simple@foo/v0.1.1") {
+		t.Errorf("expected the committed example to be pinned to v0.1.1, got:\n%s", example)
+	}
+
+	if out, err = runTool(t, tool, bare, "-commit-to-ref", "docs/update-foo", "foo/v0.1"); err == nil ||
+		!strings.Contains(out, "expected a full ref") {
+		t.Errorf("expected a short ref to be rejected, got %v\n%s", err, out)
+	}
+}
+
+func TestMainResolve(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	head := runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")
+
+	out, err := runTool(t, tool, repo, "resolve", "origin/foo/v0.1")
+	if err != nil {
+		t.Fatalf("resolve failed: %v\n%s", err, out)
+	}
+	if out != "v0.1.1\n" {
+		t.Errorf("expected the latest patch version only, got %q", out)
+	}
+	if out, err = runTool(t, tool, repo, "resolve", "-output", "json", "origin/foo/v0.1"); err != nil {
+		t.Fatalf("resolve failed: %v\n%s", err, out)
+	}
+	expected := "{\n  \"functionName\": \"foo\",\n  \"language\": \"go\",\n  \"version\": \"v0.1.1\"\n}\n"
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if branch := runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD"); branch != head {
+		t.Errorf("expected %s to stay checked out, got %s", head, branch)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+}
+
+func TestMainInspect(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	head := runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")
+
+	out, err := runTool(t, tool, repo, "inspect", "origin/foo/v0.1")
+	if err != nil {
+		t.Fatalf("inspect failed: %v\n%s", err, out)
+	}
+	var fr functionRelease
+	if err = json.Unmarshal([]byte(out), &fr); err != nil {
+		t.Fatalf("expected JSON output: %v\n%s", err, out)
+	}
+	if len(fr.Examples) != 1 {
+		t.Fatalf("expected the foo-simple example, got %+v", fr.Examples)
+	}
+	expected := functionRelease{
+		FunctionName:         "foo",
+		MinorVersion:         "v0.1",
+		Language:             "go",
+		LatestPatchVersion:   "v0.1.1",
+		PreviousPatchVersion: "v0.1.0",
+		FunctionPath:         fr.FunctionPath,
+		Examples: functionExamples{{
+			ExamplePath: fr.Examples[0].ExamplePath,
+			ExampleName: "foo-simple",
+		}},
+	}
+	if !reflect.DeepEqual(fr, expected) {
+		t.Errorf("expected %+v, got %+v", expected, fr)
+	}
+	if !strings.HasSuffix(fr.FunctionPath, filepath.Join("functions", "go", "foo")) {
+		t.Errorf("expected the path of foo, got %s", fr.FunctionPath)
+	}
+	if branch := runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD"); branch != head {
+		t.Errorf("expected %s to stay checked out, got %s", head, branch)
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "verify-all")
+	if err == nil {
+		t.Fatalf("expected stale docs to fail verification\n%s", out)
+	}
+	if !strings.Contains(out, "foo/v0.1.1 has stale docs:") ||
+		!strings.Contains(out, filepath.Join("functions", "go", "foo", "README.md")) ||
+		!strings.Contains(out, "docs of 1 of 1 functions are stale") {
+		t.Errorf("expected the stale docs of foo, got:\n%s", out)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+
+	// the docs of the release branch are current once updated
+	if out, err = runTool(t, tool, repo, "-branch", "origin/foo/v0.1"); err != nil {
+		t.Fatalf("update failed: %v\n%s", err, out)
+	}
+	if out, err = runTool(t, tool, repo, "verify-all"); err != nil {
+		t.Errorf("expected verification to pass: %v\n%s", err, out)
+	}
+}
+
+func TestMainDryRun(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+
+	out, err := runTool(t, tool, repo, "-dry-run", "-branch", "origin/foo/v0.1")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitDocsWouldChange {
+		t.Fatalf("expected exit code %d, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+	if !strings.Contains(out, "would update 3 of 3 docs") {
+		t.Errorf("expected the docs that would be updated, got:\n%s", out)
+	}
+	if !strings.Contains(out, "+$ kpt fn eval --image gcr.io/kpt-fn/foo:v0.1.1") {
+		t.Errorf("expected a diff of the docs, got:\n%s", out)
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+	// the docs are read from the release branch without checking it out
+	if branch := strings.TrimSpace(runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")); branch != "main" {
+		t.Errorf("expected main to stay checked out, got %s", branch)
+	}
+	if branches := runGit(t, repo, "branch", "--list", "foo/v0.1"); branches != "" {
+		t.Errorf("expected no local release branch, got:\n%s", branches)
+	}
+
+	// changes to the working tree don't affect the docs of the release branch
+	writeFiles(t, repo, map[string]string{"examples/foo-simple/README.md": "# changed\n"})
+	out, err = runTool(t, tool, repo, "-dry-run", "-branch", "origin/foo/v0.1")
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitDocsWouldChange {
+		t.Fatalf("expected exit code %d in a dirty repo, got %v\n%s", exitDocsWouldChange, err, out)
+	}
+	if !strings.Contains(out, "would update 3 of 3 docs") {
+		t.Errorf("expected the docs of the release branch, got:\n%s", out)
+	}
+	runGit(t, repo, "checkout", "--", "examples/foo-simple/README.md")
+
+	// the push is previewed without pushing
+	out, _ = runTool(t, tool, repo, "-dry-run", "-push", "-branch", "origin/foo/v0.1")
+	expected := "dry-run preview, nothing was pushed:\n" +
+		"remote: origin\nbase: foo/v0.1\nhead: docs/update-foo-v0.1.1\n" +
+		"title: docs: Update tags for go/foo/v0.1.1\nbody:\nRelease-Tag: go/foo/v0.1.1\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected the push preview %q, got:\n%s", expected, out)
+	}
+	if branches := runGit(t, repo, "ls-remote", "--heads", "origin", "docs/*"); branches != "" {
+		t.Errorf("expected nothing to be pushed, got:\n%s", branches)
+	}
+
+	// the docs are current once updated
+	if out, err = runTool(t, tool, repo, "-branch", "origin/foo/v0.1"); err != nil {
+		t.Fatalf("update failed: %v\n%s", err, out)
+	}
+	if out, err = runTool(t, tool, repo, "-dry-run", "-from-tag", "go/foo/v0.1.1"); err != nil {
+		t.Errorf("expected exit code 0 when no docs would change: %v\n%s", err, out)
+	}
+}
+
+func TestPreviewSeries(t *testing.T) {
+	repo := setupReleaseRepo(t)
+	tool := buildTool(t, repo)
+	outputDir := t.TempDir()
+
+	out, err := runTool(t, tool, repo, "preview-series", "-output-dir", outputDir, "foo/v0.1")
+	if err != nil {
+		t.Fatalf("preview-series failed: %v\n%s", err, out)
+	}
+	for _, version := range []string{"v0.1.0", "v0.1.1"} {
+		readme := readFile(t, filepath.Join(outputDir, version, "README.md"))
+		if !strings.Contains(readme, "gcr.io/kpt-fn/foo:"+version) {
+			t.Errorf("README not pinned to %s:\n%s", version, readme)
+		}
+	}
+	if status := runGit(t, repo, "status", "--porcelain", "--untracked-files=no"); status != "" {
+		t.Errorf("expected no changes to the repo, got:\n%s", status)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// manifestEntry is a release of a release manifest, a YAML list of entries
+// such as {function: apply-setters, language: go, minor: v0.2}
+type manifestEntry struct {
+	Function string `yaml:"function"`
+	Language string `yaml:"language"`
+	Minor    string `yaml:"minor"`
+}
+
+// readManifest returns the release branches of the entries of the release
+// manifest at path, e.g. apply-setters/v0.2, after validating every entry is a
+// function of the repo
+func readManifest(path, repoBase string) ([]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	if err = yaml.UnmarshalStrict(contents, &entries); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("manifest %s has no releases", path)
+	}
+	var branches []string
+	for i, entry := range entries {
+		if entry.Function == "" || entry.Language == "" || entry.Minor == "" {
+			return nil, fmt.Errorf("release %d of manifest %s: function, language and minor are required", i+1, path)
+		}
+		if !containsString(languages, entry.Language) {
+			return nil, fmt.Errorf("release %d of manifest %s: unknown language %s", i+1, path, entry.Language)
+		}
+		if !semver.IsValid(entry.Minor) || semver.MajorMinor(entry.Minor) != entry.Minor {
+			return nil, fmt.Errorf("release %d of manifest %s: invalid minor version %s, expected e.g. v0.2",
+				i+1, path, entry.Minor)
+		}
+		found := false
+		for _, paths := range docPathsToTry(repoBase, entry.Language, entry.Function) {
+			found = found || dirExists(paths.functionPath)
+		}
+		if !found {
+			return nil, fmt.Errorf("release %d of manifest %s: unknown function %s/%s",
+				i+1, path, entry.Language, entry.Function)
+		}
+		branches = append(branches, fmt.Sprintf("%s/%s", entry.Function, entry.Minor))
+	}
+	return branches, nil
+}
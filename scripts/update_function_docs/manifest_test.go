@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	repoBase := t.TempDir()
+	writeFiles(t, repoBase, map[string]string{
+		"functions/go/apply-setters/README.md":      "",
+		"contrib/functions/ts/set-labels/README.md": "",
+	})
+	testCases := []struct {
+		name     string
+		manifest string
+		expected []string
+		errorMsg string
+	}{
+		{
+			name: "stable and contrib functions",
+			manifest: "- function: apply-setters\n  language: go\n  minor: v0.2\n" +
+				"- function: set-labels\n  language: ts\n  minor: v1.0\n",
+			expected: []string{"apply-setters/v0.2", "set-labels/v1.0"},
+		},
+		{
+			name:     "missing field",
+			manifest: "- function: apply-setters\n  minor: v0.2\n",
+			errorMsg: "release 1 of manifest",
+		},
+		{
+			name:     "unknown function",
+			manifest: "- function: apply-setters\n  language: go\n  minor: v0.2\n- function: foo\n  language: go\n  minor: v0.1\n",
+			errorMsg: "release 2 of manifest " + filepath.Join(repoBase, "manifest.yaml") + ": unknown function go/foo",
+		},
+		{
+			name:     "patch version",
+			manifest: "- function: apply-setters\n  language: go\n  minor: v0.2.1\n",
+			errorMsg: "invalid minor version v0.2.1",
+		},
+		{
+			name:     "unknown field",
+			manifest: "- function: apply-setters\n  language: go\n  minor: v0.2\n  branch: main\n",
+			errorMsg: "invalid manifest",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeFiles(t, repoBase, map[string]string{"manifest.yaml": tc.manifest})
+			actual, err := readManifest(filepath.Join(repoBase, "manifest.yaml"), repoBase)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
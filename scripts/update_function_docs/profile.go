@@ -0,0 +1,60 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts a pprof CPU profile written to cpuProfile and returns
+// a stop func finishing it and writing a heap profile to memProfile, empty
+// paths aren't profiled
+func startProfiles(cpuProfile, memProfile string) (func() error, error) {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		var err error
+		if cpuFile, err = os.Create(cpuProfile); err != nil {
+			return nil, err
+		}
+		if err = pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("starting the CPU profile: %w", err)
+		}
+	}
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return err
+			}
+		}
+		if memProfile == "" {
+			return nil
+		}
+		memFile, err := os.Create(memProfile)
+		if err != nil {
+			return err
+		}
+		// collect the garbage so the profile has the up to date live heap
+		runtime.GC()
+		if err = pprof.WriteHeapProfile(memFile); err != nil {
+			memFile.Close()
+			return fmt.Errorf("writing the memory profile: %w", err)
+		}
+		return memFile.Close()
+	}, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartProfiles(t *testing.T) {
+	dir := t.TempDir()
+	cpuProfile := filepath.Join(dir, "cpu.prof")
+	memProfile := filepath.Join(dir, "mem.prof")
+	stop, err := startProfiles(cpuProfile, memProfile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, profile := range []string{cpuProfile, memProfile} {
+		if info, err := os.Stat(profile); err != nil || info.Size() == 0 {
+			t.Errorf("expected a profile written to %s, got %v", profile, err)
+		}
+	}
+
+	// no profiles are written when unset
+	if stop, err = startProfiles("", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = stop(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
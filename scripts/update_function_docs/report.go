@@ -0,0 +1,348 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// docUpdate records the search/replace operations on a documentation file
+type docUpdate struct {
+	Path  string
+	Count replaceCount
+	// Updated is true if the contents of the file changed
+	Updated bool
+	// FromVersions are the versions the doc referenced before the update
+	FromVersions []string
+	// BeforeSHA256 and AfterSHA256 are the hashes of the contents of updated
+	// docs before and after the update
+	BeforeSHA256 string `json:",omitempty"`
+	AfterSHA256  string `json:",omitempty"`
+}
+
+// recordDocUpdate of a doc, merging it with any previous update of the doc
+func (fr *functionRelease) recordDocUpdate(path string, count replaceCount, updated bool) {
+	for i := range fr.docUpdates {
+		if fr.docUpdates[i].Path == path {
+			fr.docUpdates[i].Count.add(count)
+			fr.docUpdates[i].Updated = fr.docUpdates[i].Updated || updated
+			return
+		}
+	}
+	fr.docUpdates = append(fr.docUpdates, docUpdate{
+		Path:    path,
+		Count:   count,
+		Updated: updated,
+	})
+}
+
+// recordChange of an updated doc, the versions it referenced and the hashes
+// of its contents before and after the update
+func (fr *functionRelease) recordChange(path string, before, after []byte) {
+	for i := range fr.docUpdates {
+		update := &fr.docUpdates[i]
+		if update.Path != path {
+			continue
+		}
+		for _, version := range fr.findStaleVersions(before) {
+			if !containsString(update.FromVersions, version) {
+				update.FromVersions = append(update.FromVersions, version)
+			}
+		}
+		// the first update of the doc has its original contents
+		if update.BeforeSHA256 == "" {
+			update.BeforeSHA256 = sha256Hex(before)
+		}
+		update.AfterSHA256 = sha256Hex(after)
+		return
+	}
+}
+
+func sha256Hex(contents []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUpdates reports whether any of the docs of the release were updated
+func (fr *functionRelease) hasUpdates() bool {
+	for _, update := range fr.docUpdates {
+		if update.Updated {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedScope describes the docs that were skipped, if any
+func (fr *functionRelease) skippedScope() string {
+	switch {
+	case fr.opts.OnlyExample != "":
+		return fmt.Sprintf(" (only example %s)", fr.opts.OnlyExample)
+	case fr.opts.SkipFunctionDoc:
+		return " (function doc skipped)"
+	case fr.opts.SkipExamples:
+		return " (example docs skipped)"
+	}
+	return ""
+}
+
+// printStaleDocs of the release, the docs an update would change, and reports
+// whether there are any
+func (fr *functionRelease) printStaleDocs() bool {
+	if !fr.hasUpdates() {
+		return false
+	}
+	infof("%s/%s has stale docs:", fr.FunctionName, fr.LatestPatchVersion)
+	for _, update := range fr.docUpdates {
+		if update.Updated {
+			infof("  %s: %d stale references", update.Path, update.Count.Replaced)
+		}
+	}
+	return true
+}
+
+// printSummary of the updated docs, and the docs that were already current
+// if reportUnchanged is set
+func (fr *functionRelease) printSummary(reportUnchanged bool) {
+	for _, line := range fr.summary(reportUnchanged) {
+		infof("%s", line)
+	}
+}
+
+// summary lines of printSummary
+func (fr *functionRelease) summary(reportUnchanged bool) []string {
+	var updated, unchanged []docUpdate
+	for _, update := range fr.docUpdates {
+		if update.Updated {
+			updated = append(updated, update)
+		} else {
+			unchanged = append(unchanged, update)
+		}
+	}
+	verb := "updated"
+	if fr.opts.DryRun {
+		verb = "would update"
+	}
+	lines := []string{fmt.Sprintf("%s %d of %d docs for %s/%s%s", verb, len(updated), len(fr.docUpdates),
+		fr.FunctionName, fr.LatestPatchVersion, fr.skippedScope())}
+	for _, update := range updated {
+		lines = append(lines,
+			fmt.Sprintf("  %s: %d of %d references updated",
+				update.Path, update.Count.Replaced, update.Count.Matches),
+			fmt.Sprintf("    sha256 %s -> %s", update.BeforeSHA256, update.AfterSHA256))
+	}
+	if fr.opts.SinceTag != "" && len(updated) > 0 {
+		lines = append(lines, fmt.Sprintf("changes since %s:", fr.opts.SinceTag))
+		for _, update := range updated {
+			from := strings.Join(update.FromVersions, ", ")
+			if from == "" {
+				from = "unpinned"
+			}
+			lines = append(lines, fmt.Sprintf("  %s: %s -> %s", update.Path, from, fr.LatestPatchVersion))
+		}
+	}
+	if len(fr.excludedExamples) > 0 {
+		lines = append(lines, fmt.Sprintf("excluded examples: %s", strings.Join(fr.excludedExamples, ", ")))
+	}
+	if len(fr.oversizedDocs) > 0 {
+		lines = append(lines, fmt.Sprintf("skipped %d docs larger than -max-file-size:", len(fr.oversizedDocs)))
+		for _, path := range fr.oversizedDocs {
+			lines = append(lines, "  "+path)
+		}
+	}
+	if !reportUnchanged || len(unchanged) == 0 {
+		return lines
+	}
+	lines = append(lines, "already current:")
+	for _, update := range unchanged {
+		lines = append(lines, fmt.Sprintf("  %s: %d references", update.Path, update.Count.Matches))
+	}
+	return lines
+}
+
+// releaseReport is the summary of a release in the JSON -report-file
+type releaseReport struct {
+	FunctionName     string      `json:"functionName"`
+	Language         string      `json:"language"`
+	Version          string      `json:"version"`
+	DryRun           bool        `json:"dryRun,omitempty"`
+	Docs             []docUpdate `json:"docs"`
+	ExcludedExamples []string    `json:"excludedExamples,omitempty"`
+	OversizedDocs    []string    `json:"oversizedDocs,omitempty"`
+}
+
+// writeReport writes the summaries of the releases to path, as JSON if path
+// ends in .json, markdown with a section per release if it ends in .md, or
+// else as printed by printSummary
+func writeReport(path string, releases []*functionRelease, reportUnchanged bool) error {
+	var contents []byte
+	switch filepath.Ext(path) {
+	case ".json":
+		reports := []releaseReport{}
+		for _, fr := range releases {
+			reports = append(reports, releaseReport{
+				FunctionName:     fr.FunctionName,
+				Language:         fr.Language,
+				Version:          fr.LatestPatchVersion,
+				DryRun:           fr.opts.DryRun,
+				Docs:             fr.docUpdates,
+				ExcludedExamples: fr.excludedExamples,
+				OversizedDocs:    fr.oversizedDocs,
+			})
+		}
+		var err error
+		if contents, err = json.MarshalIndent(reports, "", "  "); err != nil {
+			return err
+		}
+		contents = append(contents, '\n')
+	case ".md":
+		var out strings.Builder
+		for i, fr := range releases {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "## %s/%s/%s\n\n```\n%s\n```\n", fr.Language, fr.FunctionName,
+				fr.LatestPatchVersion, strings.Join(fr.summary(reportUnchanged), "\n"))
+		}
+		contents = []byte(out.String())
+	default:
+		var out strings.Builder
+		for _, fr := range releases {
+			out.WriteString(strings.Join(fr.summary(reportUnchanged), "\n") + "\n")
+		}
+		contents = []byte(out.String())
+	}
+	return writeFileAtomic(path, contents)
+}
+
+// writeFileAtomic writes contents to a temp file next to path and renames it
+// over path, so readers never see a partially written file
+func writeFileAtomic(path string, contents []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	// removing the temp file fails harmlessly once it's renamed
+	defer os.Remove(f.Name())
+	if _, err = f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// totals of the references in the docs, and the number of docs updated
+func (fr *functionRelease) totals() (replaceCount, int) {
+	var total replaceCount
+	updated := 0
+	for _, update := range fr.docUpdates {
+		total.add(update.Count)
+		if update.Updated {
+			updated++
+		}
+	}
+	return total, updated
+}
+
+// printCounts of the references in the docs, and how many would be updated
+func (fr *functionRelease) printCounts() {
+	total, stale := fr.totals()
+	infof("%s/%s: %d references in %d docs, %d stale references in %d docs",
+		fr.FunctionName, fr.LatestPatchVersion, total.Matches, len(fr.docUpdates),
+		total.Replaced, stale)
+}
+
+// printDryRunReport of the releases of a bulk dry run, one row per function of
+// whether its docs would change and the reference counts
+func printDryRunReport(releases []*functionRelease) {
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FUNCTION\tVERSION\tWOULD CHANGE\tDOCS\tSTALE DOCS\tREFERENCES\tSTALE REFERENCES")
+	for _, fr := range releases {
+		total, stale := fr.totals()
+		wouldChange := "no"
+		if stale > 0 {
+			wouldChange = "yes"
+		}
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\t%d\t%d\t%d\t%d\n", fr.Language, fr.FunctionName,
+			fr.LatestPatchVersion, wouldChange, len(fr.docUpdates), stale, total.Matches, total.Replaced)
+	}
+	_ = w.Flush()
+	infof("%s", strings.TrimRight(out.String(), "\n"))
+}
+
+// resolvedVersion of the release as written by writeVersionFile
+type resolvedVersion struct {
+	FunctionName string `json:"functionName"`
+	Language     string `json:"language"`
+	Version      string `json:"version"`
+}
+
+// writeVersionFile writes the resolved patch version of the release to path,
+// as JSON with the function name and language if path ends in .json
+func (fr *functionRelease) writeVersionFile(path string) error {
+	contents, err := fr.resolvedVersion(strings.HasSuffix(path, ".json"))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, 0644)
+}
+
+// resolvedVersion returns the patch version of the release as a line, or as
+// JSON with the function name and language if asJSON is set
+func (fr *functionRelease) resolvedVersion(asJSON bool) ([]byte, error) {
+	if !asJSON {
+		return []byte(fr.LatestPatchVersion + "\n"), nil
+	}
+	contents, err := json.MarshalIndent(resolvedVersion{
+		FunctionName: fr.FunctionName,
+		Language:     fr.Language,
+		Version:      fr.LatestPatchVersion,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(contents, '\n'), nil
+}
+
+// inspection returns the function release as indented JSON, with the exported
+// fields resolved from the release branch only
+func (fr *functionRelease) inspection() ([]byte, error) {
+	contents, err := json.MarshalIndent(fr, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(contents, '\n'), nil
+}
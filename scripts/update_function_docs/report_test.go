@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteVersionFile(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		Language:           "go",
+		LatestPatchVersion: "v1.0.3",
+	}
+	testCases := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{
+			name:     "plain version",
+			file:     "VERSION",
+			expected: "v1.0.3\n",
+		},
+		{
+			name: "JSON",
+			file: "version.json",
+			expected: "{\n" +
+				"  \"functionName\": \"apply-setters\",\n" +
+				"  \"language\": \"go\",\n" +
+				"  \"version\": \"v1.0.3\"\n" +
+				"}\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := fr.writeVersionFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if actual := readFile(t, path); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		Language:           "go",
+		LatestPatchVersion: "v1.0.3",
+		docUpdates: []docUpdate{
+			{Path: "README.md", Count: replaceCount{Matches: 2, Replaced: 1}, Updated: true,
+				BeforeSHA256: "before", AfterSHA256: "after"},
+			{Path: "metadata.yaml", Count: replaceCount{Matches: 1}},
+		},
+	}
+	summary := "updated 1 of 2 docs for apply-setters/v1.0.3\n" +
+		"  README.md: 1 of 2 references updated\n" +
+		"    sha256 before -> after\n"
+	testCases := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{
+			name:     "text",
+			file:     "report.txt",
+			expected: summary,
+		},
+		{
+			name:     "markdown",
+			file:     "report.md",
+			expected: "## go/apply-setters/v1.0.3\n\n```\n" + summary + "```\n",
+		},
+		{
+			name: "JSON",
+			file: "report.json",
+			expected: `[
+  {
+    "functionName": "apply-setters",
+    "language": "go",
+    "version": "v1.0.3",
+    "docs": [
+      {
+        "Path": "README.md",
+        "Count": {
+          "Matches": 2,
+          "Replaced": 1
+        },
+        "Updated": true,
+        "FromVersions": null,
+        "BeforeSHA256": "before",
+        "AfterSHA256": "after"
+      },
+      {
+        "Path": "metadata.yaml",
+        "Count": {
+          "Matches": 1,
+          "Replaced": 0
+        },
+        "Updated": false,
+        "FromVersions": null
+      }
+    ]
+  }
+]
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tc.file)
+			if err := writeReport(path, []*functionRelease{fr}, false); err != nil {
+				t.Fatal(err)
+			}
+			if actual := readFile(t, path); actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+			// the temp file is renamed over the report
+			if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+				t.Errorf("expected only the report in %s, got %v, %v", dir, entries, err)
+			}
+		})
+	}
+}
+
+func TestRecordChange(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.2",
+	}
+	original := []byte("apply-setters:unstable\n")
+	pinned := []byte("apply-setters:v0.2.1\n")
+	updated := []byte("apply-setters:v0.2.2\n")
+	// e.g. init inserting the pins, then the update
+	fr.recordDocUpdate("README.md", replaceCount{}, true)
+	fr.recordChange("README.md", original, pinned)
+	fr.recordChange("README.md", pinned, updated)
+	expected := docUpdate{
+		Path:         "README.md",
+		Updated:      true,
+		FromVersions: []string{"unstable", "v0.2.1"},
+		// sha256sum of the original and updated contents
+		BeforeSHA256: "d78d397b6d3103fa319d7e3f9988441f014604c07f98768c4bce69b112f6d1e7",
+		AfterSHA256:  "70e38cc02b4e58b88fb6c1c6e3ce821e243538af72fa3bbf6a12879be695d7a1",
+	}
+	if !reflect.DeepEqual(expected, fr.docUpdates[0]) {
+		t.Errorf("expected %+v, got %+v", expected, fr.docUpdates[0])
+	}
+}
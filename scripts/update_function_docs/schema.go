@@ -0,0 +1,138 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// schema of the function metadata.yaml files
+	schemaMetadata = "metadata"
+	// schema of the config file of the flags
+	schemaConfig = "config"
+)
+
+// functionMetadata is a function's metadata.yaml as parseExampleURLs decodes
+// it, and the source of its JSON schema, see metadataSchema
+type functionMetadata struct {
+	Image       string   `yaml:"image" description:"Image of the function without a tag, e.g. gcr.io/kpt-fn/apply-setters"`
+	Description string   `yaml:"description"`
+	Tags        []string `yaml:"tags"`
+	SourceURL   string   `yaml:"sourceURL"`
+	// ExamplePackageURLs may be a single string, which is warned about
+	ExamplePackageURLs stringList `yaml:"examplePackageURLs" description:"URLs of the example packages, under examples, contrib/examples or the -example-url-path of the repo. The last path segment of each URL, without its query or fragment, is the example directory, or a glob of example directories, e.g. apply-setters-*"`
+	Emails             []string   `yaml:"emails"`
+	License            string     `yaml:"license"`
+	Hidden             bool       `yaml:"hidden"`
+}
+
+// metadataSchema returns the JSON schema of the metadata.yaml files, generated
+// from the fields of functionMetadata so it can't drift from what is parsed
+func metadataSchema() ([]byte, error) {
+	properties := map[string]interface{}{}
+	t := reflect.TypeOf(functionMetadata{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		var property map[string]interface{}
+		switch field.Type {
+		case reflect.TypeOf(stringList{}):
+			property = map[string]interface{}{"oneOf": []interface{}{
+				map[string]string{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+			}}
+		case reflect.TypeOf([]string{}):
+			property = map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}}
+		case reflect.TypeOf(false):
+			property = map[string]interface{}{"type": "boolean"}
+		default:
+			property = map[string]interface{}{"type": "string"}
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "kpt function metadata.yaml",
+		"type":       "object",
+		"properties": properties,
+	}, "", "  ")
+}
+
+// configSchema returns the JSON schema of the config file of the flags, see
+// applyConfigFile
+func configSchema(fs *flag.FlagSet) ([]byte, error) {
+	properties := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if nonConfigFlags[f.Name] {
+			return
+		}
+		property := map[string]interface{}{"description": f.Usage}
+		var value interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		switch value.(type) {
+		case bool:
+			property["type"] = "boolean"
+		case int, int64:
+			property["type"] = "integer"
+		case time.Duration:
+			property["type"] = "string"
+			property["pattern"] = `^([0-9.]+(ns|us|µs|ms|s|m|h))+$`
+		case []string:
+			// lists set repeatable flags once per item
+			property["type"] = []string{"string", "array"}
+			property["items"] = map[string]string{"type": "string"}
+		default:
+			property["type"] = "string"
+		}
+		properties[f.Name] = property
+	})
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "update_function_docs config",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, "", "  ")
+}
+
+// writeSchema writes the named JSON schema
+func writeSchema(name string, fs *flag.FlagSet, w io.Writer) error {
+	var schema []byte
+	var err error
+	switch name {
+	case schemaMetadata:
+		schema, err = metadataSchema()
+	case schemaConfig:
+		schema, err = configSchema(fs)
+	default:
+		return fmt.Errorf("unknown schema: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(schema, '\n'))
+	return err
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMetadataSchemaCoversRepoMetadata(t *testing.T) {
+	var schema struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	contents, err := metadataSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(contents, &schema); err != nil {
+		t.Fatalf("invalid metadata schema: %v", err)
+	}
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join("..", "..", "functions", "*", "*", "metadata.yaml"),
+		filepath.Join("..", "..", "contrib", "functions", "*", "*", "metadata.yaml"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		t.Skip("no metadata.yaml files found in the repo")
+	}
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata map[string]interface{}
+		if err = yaml.Unmarshal(contents, &metadata); err != nil {
+			t.Fatalf("invalid %s: %v", path, err)
+		}
+		for key := range metadata {
+			if _, found := schema.Properties[key]; !found {
+				t.Errorf("%s: %s is not in the metadata schema", path, key)
+			}
+		}
+		// the schema's types are those parsed
+		var md functionMetadata
+		if err = yaml.Unmarshal(contents, &md); err != nil {
+			t.Errorf("%s doesn't parse as functionMetadata: %v", path, err)
+		}
+	}
+}
+
+func TestMetadataSchema(t *testing.T) {
+	contents, err := metadataSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	if err = json.Unmarshal(contents, &schema); err != nil {
+		t.Fatalf("invalid metadata schema: %v", err)
+	}
+	examples := schema.Properties["examplePackageURLs"]
+	if len(examples["oneOf"].([]interface{})) != 2 {
+		t.Errorf("expected examplePackageURLs to be a string or a list, got %v", examples)
+	}
+	// globs and paths under -example-url-path aren't URIs of a package
+	if strings.Contains(string(contents), `"format"`) {
+		t.Errorf("expected no format constraints, got:\n%s", contents)
+	}
+	if expected := map[string]interface{}{"type": "boolean"}; !reflect.DeepEqual(expected, schema.Properties["hidden"]) {
+		t.Errorf("expected %v, got %v", expected, schema.Properties["hidden"])
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.String("remote", "origin", "remote")
+	fs.Bool("push", false, "push")
+	fs.Duration("timeout", time.Minute, "timeout")
+	var registries []string
+	fs.Var((*stringListFlag)(&registries), "registry", "registry")
+	out, err := configSchema(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Type interface{} `json:"type"`
+		} `json:"properties"`
+	}
+	if err = json.Unmarshal(out, &schema); err != nil {
+		t.Fatal(err)
+	}
+	actual := map[string]interface{}{}
+	for name, property := range schema.Properties {
+		actual[name] = property.Type
+	}
+	expected := map[string]interface{}{
+		"remote":   "string",
+		"push":     "boolean",
+		"timeout":  "string",
+		"registry": []interface{}{"string", "array"},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/mod/semver"
+)
+
+// functionStaleness is how far the function README lags behind the latest
+// patch version of the function
+type functionStaleness struct {
+	Function string
+	// Referenced is the oldest patch version the README references
+	Referenced string
+	Latest     string
+	// Gap is the number of patch versions released after the referenced one,
+	// up to and including the latest
+	Gap int
+}
+
+// stalenessGap returns the number of released versions after referenced, up
+// to and including latest
+func stalenessGap(referenced, latest string, released []string) int {
+	counted := map[string]bool{}
+	for _, version := range released {
+		if counted[version] || semver.Compare(version, referenced) <= 0 || semver.Compare(version, latest) > 0 {
+			continue
+		}
+		counted[version] = true
+	}
+	return len(counted)
+}
+
+// oldestReferencedPatch returns the oldest patch version of the references,
+// empty if none pins a patch version
+func oldestReferencedPatch(references []versionReference) string {
+	oldest := ""
+	for _, reference := range references {
+		// skips unstable and minor version references
+		version := reference.Version
+		if semver.Canonical(version) != version {
+			continue
+		}
+		if oldest == "" || semver.Compare(version, oldest) < 0 {
+			oldest = version
+		}
+	}
+	return oldest
+}
+
+// sortStaleness sorts the functions most stale first, then by function
+func sortStaleness(functions []functionStaleness) {
+	sort.SliceStable(functions, func(i, j int) bool {
+		if functions[i].Gap != functions[j].Gap {
+			return functions[i].Gap > functions[j].Gap
+		}
+		return functions[i].Function < functions[j].Function
+	})
+}
+
+// staleness returns how far the function README lags behind the latest
+// release, false if the README pins no patch version
+func (fr *functionRelease) staleness(tags []string) (functionStaleness, bool, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(fr.FunctionPath, "README.md"))
+	if err != nil {
+		return functionStaleness{}, false, err
+	}
+	referenced := oldestReferencedPatch(fr.findVersionReferences(string(contents)))
+	if referenced == "" {
+		return functionStaleness{}, false, nil
+	}
+	var candidates []releaseTag
+	for _, tag := range tags {
+		if candidate, ok := parseReleaseTag(tag); ok &&
+			candidate.Language == fr.Language && candidate.FunctionName == fr.FunctionName {
+			candidates = append(candidates, candidate)
+		}
+	}
+	var released []string
+	for _, candidate := range fr.signedTags(candidates) {
+		released = append(released, candidate.PatchVersion)
+	}
+	return functionStaleness{
+		Function:   fr.Language + "/" + fr.FunctionName,
+		Referenced: referenced,
+		Latest:     fr.LatestPatchVersion,
+		Gap:        stalenessGap(referenced, fr.LatestPatchVersion, released),
+	}, true, nil
+}
+
+// printStaleness prints the functions as a table
+func printStaleness(functions []functionStaleness) {
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FUNCTION\tREFERENCED\tLATEST\tGAP")
+	for _, function := range functions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", function.Function, function.Referenced, function.Latest, function.Gap)
+	}
+	_ = w.Flush()
+	infof("%s", strings.TrimRight(out.String(), "\n"))
+}
+
+// staleness prints the functions whose README references a version older than
+// their latest release, most stale first
+func staleness(args arguments) error {
+	if err := gitFetch(); err != nil {
+		return err
+	}
+	refs, err := latestReleaseTags(args.Release)
+	if err != nil {
+		return err
+	}
+	tags, err := (&functionRelease{opts: args.Release}).listTags()
+	if err != nil {
+		return err
+	}
+	opts := args.Release
+	opts.CountOnly = true
+	var functions []functionStaleness
+	for _, ref := range refs {
+		fr, err := newFunctionRelease(ref, opts)
+		if err != nil {
+			warnf("skipping %s: %v", ref, err)
+			continue
+		}
+		function, pinned, err := fr.staleness(tags)
+		if err != nil {
+			return err
+		}
+		if !pinned {
+			warnf("skipping %s: README pins no patch version", ref)
+			continue
+		}
+		functions = append(functions, function)
+	}
+	sortStaleness(functions)
+	printStaleness(functions)
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStalenessGap(t *testing.T) {
+	released := []string{"v0.1.0", "v0.1.1", "v0.1.1", "v0.2.0", "v0.2.1", "v0.3.0-rc1", "v0.3.0"}
+	testCases := []struct {
+		referenced string
+		latest     string
+		expected   int
+	}{
+		{referenced: "v0.1.0", latest: "v0.2.1", expected: 3},
+		{referenced: "v0.2.1", latest: "v0.2.1"},
+		{referenced: "v0.1.1", latest: "v0.3.0", expected: 4},
+		{referenced: "v0.2.0", latest: "v0.2.1", expected: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.referenced+"-"+tc.latest, func(t *testing.T) {
+			if actual := stalenessGap(tc.referenced, tc.latest, released); actual != tc.expected {
+				t.Errorf("expected a gap of %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSortStaleness(t *testing.T) {
+	functions := []functionStaleness{
+		{Function: "go/foo", Gap: 1},
+		{Function: "go/current"},
+		{Function: "go/qux", Gap: 3},
+		{Function: "go/bar", Gap: 1},
+	}
+	sortStaleness(functions)
+	var actual []string
+	for _, function := range functions {
+		actual = append(actual, function.Function)
+	}
+	expected := []string{"go/qux", "go/bar", "go/foo", "go/current"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFunctionStaleness(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"README.md": "# foo\n\n" +
+			"$ kpt fn eval --image gcr.io/kpt-fn/foo:v0.1.1\n" +
+			"$ kpt fn eval --image gcr.io/kpt-fn/foo:v0.1.0-rc1\n" +
+			"$ kpt fn eval --image gcr.io/kpt-fn/foo:v0.2\n" +
+			"$ kpt fn eval --image gcr.io/kpt-fn/foo:unstable\n",
+		"unpinned/README.md": "$ kpt fn eval --image gcr.io/kpt-fn/foo:unstable\n",
+	})
+	tags := []string{
+		"functions/go/foo/v0.1.0", "functions/go/foo/v0.1.1", "functions/go/foo/v0.1.2",
+		"functions/go/foo/v0.2.0", "functions/go/foobar/v0.3.0", "functions/ts/foo/v0.2.1",
+	}
+	fr := &functionRelease{
+		FunctionName:       "foo",
+		Language:           "go",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.0",
+		FunctionPath:       dir,
+	}
+	actual, pinned, err := fr.staleness(tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := functionStaleness{Function: "go/foo", Referenced: "v0.1.1", Latest: "v0.2.0", Gap: 2}
+	if !pinned || actual != expected {
+		t.Errorf("expected %+v, got %+v (pinned %v)", expected, actual, pinned)
+	}
+
+	fr.FunctionPath = filepath.Join(dir, "unpinned")
+	if _, pinned, err = fr.staleness(tags); err != nil || pinned {
+		t.Errorf("expected an unpinned README, got pinned %v, %v", pinned, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// transformer is a custom search/replace operation run after the built-in
+// ones, either a Go template (*.tmpl) or an executable
+type transformer struct {
+	path string
+	// tmpl is set for template transformers
+	tmpl *template.Template
+}
+
+// transformerData is the data of template transformers
+type transformerData struct {
+	Path               string
+	Content            string
+	FunctionName       string
+	Language           string
+	MinorVersion       string
+	LatestPatchVersion string
+}
+
+// templateFuncs available to template transformers
+var templateFuncs = template.FuncMap{
+	"replace": strings.ReplaceAll,
+}
+
+// readTransformers from the files in dir, in name order. Templates receive the
+// doc as .Content along with the release, e.g. .LatestPatchVersion, and
+// executables receive the doc on stdin and the release in the environment,
+// e.g. LATEST_PATCH_VERSION. Both output the transformed doc. Other files are
+// ignored.
+func readTransformers(dir string) ([]transformer, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var transformers []transformer
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		switch {
+		case file.IsDir():
+			continue
+		case strings.HasSuffix(file.Name(), ".tmpl"):
+			tmpl, err := template.New(file.Name()).Funcs(templateFuncs).ParseFiles(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transformer %s: %w", path, err)
+			}
+			transformers = append(transformers, transformer{path: path, tmpl: tmpl})
+		case file.Mode()&0111 != 0:
+			transformers = append(transformers, transformer{path: path})
+		}
+	}
+	return transformers, nil
+}
+
+// transform the contents of the doc at filePath
+func (t transformer) transform(fr *functionRelease, filePath string, contents []byte) ([]byte, error) {
+	if t.tmpl != nil {
+		var out bytes.Buffer
+		err := t.tmpl.Execute(&out, transformerData{
+			Path:               filePath,
+			Content:            string(contents),
+			FunctionName:       fr.FunctionName,
+			Language:           fr.Language,
+			MinorVersion:       fr.MinorVersion,
+			LatestPatchVersion: fr.LatestPatchVersion,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("transformer %s failed on %s: %w", t.path, filePath, err)
+		}
+		return out.Bytes(), nil
+	}
+	cmd := exec.Command(t.path)
+	cmd.Stdin = bytes.NewReader(contents)
+	cmd.Env = append(os.Environ(),
+		"DOC_PATH="+filePath,
+		"FUNCTION_NAME="+fr.FunctionName,
+		"LANGUAGE="+fr.Language,
+		"MINOR_VERSION="+fr.MinorVersion,
+		"LATEST_PATCH_VERSION="+fr.LatestPatchVersion,
+	)
+	stdout, err := runExecCmd(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("transformer %s failed on %s: %w", t.path, filePath, err)
+	}
+	return []byte(stdout), nil
+}
+
+// runTransformers of the release on the contents of the doc at filePath
+func (fr *functionRelease) runTransformers(filePath string, contents []byte) ([]byte, error) {
+	var err error
+	for _, t := range fr.transformers {
+		if contents, err = t.transform(fr, filePath, contents); err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
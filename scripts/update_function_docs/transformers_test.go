@@ -0,0 +1,58 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTransformers(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"01-chart.tmpl": `{{replace .Content "chart-version: old" (printf "chart-version: %s" .LatestPatchVersion)}}`,
+		"02-badge.sh":   "#!/bin/sh\nsed \"s|badge/$FUNCTION_NAME-[^)]*|badge/$FUNCTION_NAME-$MINOR_VERSION|\"\n",
+		"README.md":     "not a transformer\n",
+	})
+	if err := os.Chmod(filepath.Join(dir, "02-badge.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	transformers, err := readTransformers(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transformers) != 2 {
+		t.Fatalf("expected 2 transformers, got %d", len(transformers))
+	}
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.1",
+		transformers:       transformers,
+	}
+	contents := "chart-version: old\n![](badge/apply-setters-v0.1)\n"
+	expected := "chart-version: v0.2.1\n![](badge/apply-setters-v0.2)\n"
+	actual, err := fr.runTransformers("README.md", []byte(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual) != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gitTree is the tree of a commit the docs are read from instead of the
+// working tree, for -commit-to-ref. Files are addressed by their path under
+// base, as they would be in a checkout of the commit at base.
+type gitTree struct {
+	commit string
+	base   string
+	// modes of the files by slash separated path relative to base
+	modes map[string]string
+	// sizes of the files in bytes by slash separated path relative to base
+	sizes map[string]int64
+	// dirs containing the files, by slash separated path relative to base
+	dirs map[string]bool
+}
+
+// readGitTree lists the files of the tree of the ref's commit
+func readGitTree(ref, base string) (*gitTree, error) {
+	commit, err := gitRevParseCommit(ref)
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := gitLsTree(commit)
+	if err != nil {
+		return nil, err
+	}
+	tree := &gitTree{commit: commit, base: base, modes: map[string]string{}, sizes: map[string]int64{}, dirs: map[string]bool{}}
+	for _, entry := range strings.Split(stdout, "\x00") {
+		tab := strings.Index(entry, "\t")
+		if tab < 0 {
+			continue
+		}
+		// <mode> <type> <object> <size>\t<path>
+		fields := strings.Fields(entry[:tab])
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git ls-tree entry %q: %w", entry, err)
+		}
+		file := entry[tab+1:]
+		tree.modes[file] = fields[0]
+		tree.sizes[file] = size
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			tree.dirs[dir] = true
+		}
+	}
+	return tree, nil
+}
+
+// relPath returns the path of the file relative to base, or false if it
+// isn't under base
+func (t *gitTree) relPath(filePath string) (string, bool) {
+	rel, err := filepath.Rel(t.base, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (t *gitTree) dirExists(dirPath string) bool {
+	rel, ok := t.relPath(dirPath)
+	return ok && (rel == "." || t.dirs[rel])
+}
+
+func (t *gitTree) fileExists(filePath string) bool {
+	rel, ok := t.relPath(filePath)
+	return ok && (t.modes[rel] != "" || t.dirs[rel])
+}
+
+// glob returns the files and dirs matching the pattern, see path.Match
+func (t *gitTree) glob(pattern string) ([]string, error) {
+	rel, ok := t.relPath(pattern)
+	if !ok {
+		return nil, nil
+	}
+	var matches []string
+	match := func(name string) error {
+		matched, err := path.Match(rel, name)
+		if err != nil {
+			return err
+		}
+		if matched {
+			matches = append(matches, filepath.Join(t.base, filepath.FromSlash(name)))
+		}
+		return nil
+	}
+	for file := range t.modes {
+		if err := match(file); err != nil {
+			return nil, err
+		}
+	}
+	for dir := range t.dirs {
+		if err := match(dir); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (t *gitTree) fileSize(filePath string) (int64, error) {
+	rel, ok := t.relPath(filePath)
+	if !ok || t.modes[rel] == "" {
+		return 0, fmt.Errorf("%s not found in the tree of %s", filePath, t.commit)
+	}
+	return t.sizes[rel], nil
+}
+
+func (t *gitTree) readFile(filePath string) ([]byte, error) {
+	rel, ok := t.relPath(filePath)
+	if !ok || t.modes[rel] == "" {
+		return nil, fmt.Errorf("%s not found in the tree of %s", filePath, t.commit)
+	}
+	return gitCatFileBlob(t.commit, rel)
+}
+
+// commitDocs writes a commit of the tree with the updated docs, by path, on top of
+// the tree's commit with a temporary index, and returns its SHA
+func (t *gitTree) commitDocs(docs map[string][]byte, msg string) (string, error) {
+	dir, err := os.MkdirTemp("", "update_function_docs-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	index := filepath.Join(dir, "index")
+	if _, err = gitWithIndex(index, "read-tree", t.commit); err != nil {
+		return "", err
+	}
+	var paths []string
+	for filePath := range docs {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	for _, filePath := range paths {
+		rel, ok := t.relPath(filePath)
+		if !ok || t.modes[rel] == "" {
+			return "", fmt.Errorf("%s not found in the tree of %s", filePath, t.commit)
+		}
+		blob, err := gitHashObject(docs[filePath])
+		if err != nil {
+			return "", err
+		}
+		if _, err = gitWithIndex(index, "update-index", "--cacheinfo",
+			fmt.Sprintf("%s,%s,%s", t.modes[rel], blob, rel)); err != nil {
+			return "", err
+		}
+	}
+	stdout, err := gitWithIndex(index, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return gitCommitTree(strings.TrimSpace(stdout), t.commit, msg)
+}
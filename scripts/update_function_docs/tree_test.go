@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitTree(t *testing.T) {
+	repo := setupRepo(t)
+	writeFiles(t, repo, map[string]string{
+		"functions/go/foo/README.md":     "# foo\n",
+		"functions/go/foo/metadata.yaml": "image: gcr.io/kpt-fn/foo\n",
+		"functions/ts/bar/README.md":     "# bar\n",
+	})
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "add functions")
+	// changes of the working tree aren't read
+	writeFiles(t, repo, map[string]string{"functions/go/foo/README.md": "# changed\n"})
+	base := filepath.Join("/", "base")
+	tree, err := readGitTree("HEAD", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.dirExists(filepath.Join(base, "functions", "go", "foo")) || tree.dirExists(filepath.Join(base, "functions", "go", "bar")) {
+		t.Error("expected only the dirs of the tree to exist")
+	}
+	if !tree.fileExists(filepath.Join(base, "functions", "go", "foo", "metadata.yaml")) || tree.fileExists(filepath.Join(repo, "README.md")) {
+		t.Error("expected only the files of the tree under the base to exist")
+	}
+	matches, err := tree.glob(filepath.Join(base, "functions", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(base, "functions", "go", "foo"), filepath.Join(base, "functions", "ts", "bar")}
+	if !reflect.DeepEqual(expected, matches) {
+		t.Errorf("expected %v, got %v", expected, matches)
+	}
+	if matches, err = tree.glob(filepath.Join(base, "functions", "go", "foo", "*.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if expected = []string{filepath.Join(base, "functions", "go", "foo", "metadata.yaml")}; !reflect.DeepEqual(expected, matches) {
+		t.Errorf("expected %v, got %v", expected, matches)
+	}
+	readme := filepath.Join(base, "functions", "go", "foo", "README.md")
+	contents, err := tree.readFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "# foo\n" {
+		t.Errorf("expected the committed README, got %q", contents)
+	}
+	size, err := tree.fileSize(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len("# foo\n")) {
+		t.Errorf("expected the size of the committed README, got %d", size)
+	}
+	if _, err = tree.fileSize(filepath.Join(base, "missing.md")); err == nil {
+		t.Error("expected no size of a file missing from the tree")
+	}
+
+	commit, err := tree.commitDocs(map[string][]byte{readme: []byte("# foo v1\n")}, "docs: update foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := runGit(t, repo, "show", commit+":functions/go/foo/README.md"); actual != "# foo v1\n" {
+		t.Errorf("expected the updated README in the commit, got %q", actual)
+	}
+	if files := strings.Fields(runGit(t, repo, "diff-tree", "--no-commit-id", "--name-only", "-r", commit)); !reflect.DeepEqual(files, []string{"functions/go/foo/README.md"}) {
+		t.Errorf("expected only the README to change, got %v", files)
+	}
+	if staged := runGit(t, repo, "diff", "--cached", "--name-only"); staged != "" {
+		t.Errorf("expected the repo's index to be untouched, got %s", staged)
+	}
+	if _, err = tree.commitDocs(map[string][]byte{filepath.Join(base, "missing.md"): nil}, "docs"); err == nil {
+		t.Error("expected a doc missing from the tree to fail the commit")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// urlCheck is the result of validating a URL, its HTTP status or the error of
+// the request
+type urlCheck struct {
+	status int
+	err    error
+}
+
+var (
+	// urlChecks caches the results of the URLs validated by the run, which may
+	// share them between releases, failed requests included
+	urlChecks = map[string]urlCheck{}
+	// headStatus returns the HTTP status of a HEAD request of the URL,
+	// following redirects, until cmdContext is done
+	headStatus = func(url string) (int, error) {
+		req, err := http.NewRequestWithContext(cmdContext, http.MethodHead, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+)
+
+// validateURLs warns of the catalog URLs rewritten by the update that aren't
+// reachable, e.g. of a version that was never published to the site. Other
+// catalog URLs of the docs are left to their authors.
+func (fr *functionRelease) validateURLs() {
+	for _, url := range fr.rewrittenURLs {
+		check, found := urlChecks[url]
+		if !found {
+			check.status, check.err = headStatus(url)
+			urlChecks[url] = check
+		}
+		if check.err != nil {
+			warnf("failed to validate catalog URL %s: %v", url, check.err)
+			continue
+		}
+		if check.status != http.StatusOK {
+			warnf("catalog URL %s is not reachable: %d %s", url, check.status, http.StatusText(check.status))
+		}
+	}
+}
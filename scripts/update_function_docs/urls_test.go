@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateURLs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"README.md": "See https://catalog.kpt.dev/apply-setters/v0.9/ and https://catalog.kpt.dev/apply-setters/v0.9/\n",
+		"other.md":  "See https://catalog.kpt.dev/apply-setters/v1.0/\n",
+	})
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		Language:           "go",
+		opts:               releaseOptions{DryRun: true},
+	}
+	var requested []string
+	defer func(head func(string) (int, error)) { headStatus = head }(headStatus)
+	headStatus = func(url string) (int, error) {
+		requested = append(requested, url)
+		return http.StatusNotFound, nil
+	}
+	defer func(checks map[string]urlCheck) { urlChecks = checks }(urlChecks)
+	urlChecks = map[string]urlCheck{}
+	defer func(count int) { warningCount = count }(warningCount)
+	defer func(out *os.File) { levelWarn.out = out }(levelWarn.out)
+	f, err := os.Create(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	levelWarn.out = f
+	warningCount = 0
+
+	// the URLs the update didn't rewrite are left alone
+	if err = fr.updateDoc(filepath.Join(dir, "other.md")); err != nil {
+		t.Fatal(err)
+	}
+	fr.validateURLs()
+	if len(requested) != 0 {
+		t.Errorf("expected no requests of the current URLs, got %v", requested)
+	}
+
+	// the rewritten URLs are requested once per run
+	if err = fr.updateDoc(filepath.Join(dir, "README.md")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		fr.validateURLs()
+	}
+	if expected := []string{"https://catalog.kpt.dev/apply-setters/v1.0"}; !reflect.DeepEqual(expected, requested) {
+		t.Errorf("expected the requests %v, got %v", expected, requested)
+	}
+	if warningCount != 2 {
+		t.Errorf("expected a warning of the unreachable URL per validation, got %d", warningCount)
+	}
+
+	// failed requests are cached too
+	requested = nil
+	headStatus = func(url string) (int, error) {
+		requested = append(requested, url)
+		return 0, errors.New("connection refused")
+	}
+	urlChecks = map[string]urlCheck{}
+	warningCount = 0
+	for i := 0; i < 2; i++ {
+		fr.validateURLs()
+	}
+	if len(requested) != 1 {
+		t.Errorf("expected the failed request not to be retried, got %v", requested)
+	}
+	if warningCount != 2 {
+		t.Errorf("expected a warning of the failed request per validation, got %d", warningCount)
+	}
+}
+
+func TestHeadStatusCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer func(ctx context.Context) { cmdContext = ctx }(cmdContext)
+	ctx, cancel := context.WithCancel(context.Background())
+	cmdContext = ctx
+
+	if status, err := headStatus(server.URL); err != nil || status != http.StatusOK {
+		t.Fatalf("expected %d, got %d %v", http.StatusOK, status, err)
+	}
+	cancel()
+	if _, err := headStatus(server.URL); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the request to be canceled with cmdContext, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// shellFencePattern matches the fenced shell code blocks of markdown
+	// docs, the first group is the script in the block
+	shellFencePattern = regexp.MustCompile("(?ms)^[ \t]*```(?:sh|shell|bash|zsh|console)[ \t]*\n(.*?)^[ \t]*```")
+	// shellVarNamePattern matches the names of shell variables
+	shellVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// replace the patch versions assigned to the VersionVar variable in fenced
+// shell blocks with the latest patch version, for snippets referencing the
+// function through the variable, e.g. for the variable VERSION
+// export VERSION=v1.0.0 -> export VERSION=v1.0.1
+// Prose outside of the shell blocks is left untouched.
+func (fr *functionRelease) replaceVersionVar(contents []byte) ([]byte, replaceCount) {
+	assignmentPattern := regexp.MustCompile(fmt.Sprintf(`((?:^|[\s;&|(])(?:export\s+)?%s=["']?)(v\d+\.\d+\.\d+)(["'\s;&|)]|$)`,
+		regexp.QuoteMeta(fr.opts.VersionVar)))
+	var total replaceCount
+	updated, _ := replaceAllFunc(shellFencePattern, contents, func(match []int) ([]byte, bool) {
+		block, count := replaceAll(assignmentPattern, contents[match[2]:match[3]],
+			fmt.Sprintf("${1}%s${3}", fr.LatestPatchVersion))
+		if count.Matches == 0 {
+			return nil, false
+		}
+		total.add(count)
+		var replacement []byte
+		replacement = append(replacement, contents[match[0]:match[2]]...)
+		replacement = append(replacement, block...)
+		return append(replacement, contents[match[3]:match[1]]...), true
+	})
+	return updated, total
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"testing"
+)
+
+func TestReplaceVersionVar(t *testing.T) {
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v1.0",
+		LatestPatchVersion: "v1.0.1",
+		opts:               releaseOptions{VersionVar: "VERSION"},
+	}
+	input := "Set VERSION=v1.0.0 to pin the function.\n\n" +
+		"```shell\n" +
+		"VERSION=v1.0.0\n" +
+		"export VERSION=\"v1.0.0\"\n" +
+		"OTHER_VERSION=v0.3.0 VERSION=v0.9.2; echo $VERSION\n" +
+		"VERSION=v1.0.0-rc1\n" +
+		"kpt fn eval --image gcr.io/kpt-fn/apply-setters:$VERSION\n" +
+		"```\n\n" +
+		"```yaml\n" +
+		"VERSION=v1.0.0\n" +
+		"```\n"
+	expected := "Set VERSION=v1.0.0 to pin the function.\n\n" +
+		"```shell\n" +
+		"VERSION=v1.0.1\n" +
+		"export VERSION=\"v1.0.1\"\n" +
+		"OTHER_VERSION=v0.3.0 VERSION=v1.0.1; echo $VERSION\n" +
+		"VERSION=v1.0.0-rc1\n" +
+		"kpt fn eval --image gcr.io/kpt-fn/apply-setters:$VERSION\n" +
+		"```\n\n" +
+		"```yaml\n" +
+		"VERSION=v1.0.0\n" +
+		"```\n"
+	updated, count := fr.replaceVersionVar([]byte(input))
+	if actual := string(updated); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expected := (replaceCount{Matches: 3, Replaced: 3}); count != expected {
+		t.Errorf("expected %+v, got %+v", expected, count)
+	}
+	if _, count = fr.replaceVersionVar(updated); count.Replaced != 0 {
+		t.Errorf("expected the updated assignments to be current, got %+v", count)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// yamlFencePattern matches the fenced yaml code blocks of markdown docs,
+	// the first group is the YAML in the block
+	yamlFencePattern = regexp.MustCompile("(?ms)^[ \t]*```ya?ml[ \t]*\n(.*?)^[ \t]*```")
+	// yamlListEntryPattern matches a version list entry, a patch version
+	// optionally following a name and a : or /, e.g. apply-setters:v0.2.1
+	yamlListEntryPattern = regexp.MustCompile(`^(?:(.*)[:/])?(v\d+\.\d+\.\d+)$`)
+)
+
+// replace the latest entry of the release in the version lists of fenced
+// YAML blocks at the YAMLVersionLists paths with the latest patch version,
+// leaving the entries of earlier patch versions and other releases as the
+// version history, e.g. for the path versions
+// versions: [v0.1.3, v0.2.0, v0.2.1] ->
+// versions: [v0.1.3, v0.2.0, v0.2.2]
+// The entries are bare versions or references ending in the function name, a
+// : or / and the version. Only the entry is rewritten in the block, the rest
+// of the YAML is left as is.
+func (fr *functionRelease) replaceYAMLVersionLists(contents []byte) ([]byte, replaceCount) {
+	return replaceAllFunc(yamlFencePattern, contents, func(match []int) ([]byte, bool) {
+		block := contents[match[2]:match[3]]
+		found := false
+		for _, keyPath := range fr.opts.YAMLVersionLists {
+			var ok bool
+			if block, ok = fr.replaceYAMLVersionList(block, strings.Split(keyPath, ".")); ok {
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		var replacement []byte
+		replacement = append(replacement, contents[match[0]:match[2]]...)
+		replacement = append(replacement, block...)
+		return append(replacement, contents[match[3]:match[1]]...), true
+	})
+}
+
+// replaceYAMLVersionList bumps the latest entry of the release in the list at
+// the key path of the YAML block, and reports whether the list has an entry of
+// the release
+func (fr *functionRelease) replaceYAMLVersionList(block []byte, keys []string) ([]byte, bool) {
+	var doc interface{}
+	if err := yaml.Unmarshal(block, &doc); err != nil {
+		return block, false
+	}
+	entries, ok := yamlListAt(doc, keys)
+	if !ok {
+		return block, false
+	}
+	latest := -1
+	var latestVersion string
+	for i, entry := range entries {
+		version, ok := fr.yamlListEntryVersion(entry)
+		if ok && (latest < 0 || semver.Compare(version, latestVersion) > 0) {
+			latest, latestVersion = i, version
+		}
+	}
+	if latest < 0 {
+		return block, false
+	}
+	if semver.Compare(latestVersion, fr.LatestPatchVersion) >= 0 {
+		return block, true
+	}
+	entry := entries[latest].(string)
+	bumped := strings.TrimSuffix(entry, latestVersion) + fr.LatestPatchVersion
+	start, end, ok := yamlKeyRange(block, keys)
+	if !ok {
+		fr.warnYAMLListSkipped(entry, keys, "the list could not be located in the YAML")
+		return block, true
+	}
+	entryPattern := regexp.MustCompile(`(^|[\s\[,'"])` + regexp.QuoteMeta(entry) + `($|[\s\],'"#])`)
+	loc := entryPattern.FindSubmatchIndex(block[start:end])
+	if loc == nil {
+		fr.warnYAMLListSkipped(entry, keys, "the entry could not be located in the list")
+		return block, true
+	}
+	var updated []byte
+	updated = append(updated, block[:start+loc[3]]...)
+	updated = append(updated, bumped...)
+	updated = append(updated, block[start+loc[4]:]...)
+
+	// the edit must only have changed the entry, e.g. not an anchor of it
+	expected := append([]interface{}{}, entries...)
+	expected[latest] = bumped
+	var updatedDoc interface{}
+	if err := yaml.Unmarshal(updated, &updatedDoc); err != nil {
+		fr.warnYAMLListSkipped(entry, keys, fmt.Sprintf("the bumped YAML is invalid: %v", err))
+		return block, true
+	}
+	if actual, ok := yamlListAt(updatedDoc, keys); !ok || !reflect.DeepEqual(actual, expected) {
+		fr.warnYAMLListSkipped(entry, keys, "the bump would change more than the entry, e.g. an alias of it")
+		return block, true
+	}
+	return updated, true
+}
+
+// warnYAMLListSkipped warns that the stale entry of the list at the key path
+// was left as is
+func (fr *functionRelease) warnYAMLListSkipped(entry string, keys []string, reason string) {
+	doc := fr.docPath
+	if doc == "" {
+		doc = "the doc"
+	}
+	warnf("not bumping %s to %s in the %s list of %s: %s",
+		entry, fr.LatestPatchVersion, strings.Join(keys, "."), doc, reason)
+}
+
+// yamlMaskFormat is the placeholder of a masked list, NUL delimited so no
+// search/replace operation matches it
+const yamlMaskFormat = "\x00yaml-version-list-%d\x00"
+
+// maskYAMLVersionLists replaces the lists at the YAMLVersionLists paths of the
+// fenced YAML blocks with placeholders, returning the masked lists to put
+// back with unmaskYAMLVersionLists
+func (fr *functionRelease) maskYAMLVersionLists(contents []byte) ([]byte, [][]byte) {
+	type byteRange struct{ start, end int }
+	var ranges []byteRange
+	for _, match := range yamlFencePattern.FindAllSubmatchIndex(contents, -1) {
+		block := contents[match[2]:match[3]]
+		for _, keyPath := range fr.opts.YAMLVersionLists {
+			if start, end, ok := yamlKeyRange(block, strings.Split(keyPath, ".")); ok {
+				ranges = append(ranges, byteRange{match[2] + start, match[2] + end})
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return contents, nil
+	}
+	// the lists of nested key paths overlap
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	var masked [][]byte
+	var result []byte
+	last := 0
+	for _, r := range ranges {
+		if r.start < last {
+			if r.end > last {
+				masked[len(masked)-1] = append(masked[len(masked)-1], contents[last:r.end]...)
+				last = r.end
+			}
+			continue
+		}
+		result = append(result, contents[last:r.start]...)
+		result = append(result, fmt.Sprintf(yamlMaskFormat, len(masked))...)
+		masked = append(masked, append([]byte{}, contents[r.start:r.end]...))
+		last = r.end
+	}
+	return append(result, contents[last:]...), masked
+}
+
+// unmaskYAMLVersionLists puts back the lists masked by maskYAMLVersionLists
+func unmaskYAMLVersionLists(contents []byte, masked [][]byte) []byte {
+	for i, list := range masked {
+		contents = bytes.Replace(contents, []byte(fmt.Sprintf(yamlMaskFormat, i)), list, 1)
+	}
+	return contents
+}
+
+// yamlListEntryVersion returns the patch version of a list entry of the
+// release
+func (fr *functionRelease) yamlListEntryVersion(entry interface{}) (string, bool) {
+	value, ok := entry.(string)
+	if !ok {
+		return "", false
+	}
+	submatch := yamlListEntryPattern.FindStringSubmatch(value)
+	if submatch == nil || semver.MajorMinor(submatch[2]) != fr.MinorVersion {
+		return "", false
+	}
+	name := submatch[1]
+	if name != "" && name != fr.FunctionName && !strings.HasSuffix(name, "/"+fr.FunctionName) {
+		return "", false
+	}
+	return submatch[2], true
+}
+
+// yamlListAt returns the list at the key path of the decoded YAML
+func yamlListAt(doc interface{}, keys []string) ([]interface{}, bool) {
+	for _, key := range keys {
+		m, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	list, ok := doc.([]interface{})
+	return list, ok
+}
+
+// yamlKeyRange returns the byte range of the YAML block from the line of the
+// last key of the path to the end of its value, found by indentation
+func yamlKeyRange(block []byte, keys []string) (int, int, bool) {
+	type line struct {
+		start, end, indent int
+		text               string
+	}
+	var lines []line
+	for start := 0; start < len(block); {
+		end := bytes.IndexByte(block[start:], '\n')
+		if end < 0 {
+			end = len(block)
+		} else {
+			end += start + 1
+		}
+		text := strings.TrimRight(string(block[start:end]), "\r\n")
+		trimmed := strings.TrimLeft(text, " ")
+		// blank and comment lines don't delimit values
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			lines = append(lines, line{start: start, end: end, indent: len(text) - len(trimmed), text: trimmed})
+		}
+		start = end
+	}
+	first, last, parentIndent := 0, len(lines), -1
+	for i, key := range keys {
+		if first >= last {
+			return 0, 0, false
+		}
+		// the keys of the value are at the indentation of its first line
+		indent := lines[first].indent
+		if indent <= parentIndent {
+			return 0, 0, false
+		}
+		found := -1
+		for j := first; j < last; j++ {
+			if lines[j].indent == indent && isYAMLKeyLine(lines[j].text, key) {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			return 0, 0, false
+		}
+		end := found + 1
+		for end < last && (lines[end].indent > indent ||
+			lines[end].indent == indent && strings.HasPrefix(lines[end].text, "-")) {
+			end++
+		}
+		first, last, parentIndent = found, end, indent
+		// the keys of the next value are after the key line
+		if i < len(keys)-1 {
+			first++
+		}
+	}
+	return lines[first].start, lines[last-1].end, true
+}
+
+// isYAMLKeyLine reports whether the line, without its indentation, starts the
+// value of the key
+func isYAMLKeyLine(text, key string) bool {
+	for _, quoted := range []string{key, `"` + key + `"`, "'" + key + "'"} {
+		if strings.HasPrefix(text, quoted+":") {
+			return true
+		}
+	}
+	return false
+}
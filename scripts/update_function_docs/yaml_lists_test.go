@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceYAMLVersionLists(t *testing.T) {
+	fence := "```"
+	testCases := []struct {
+		name     string
+		paths    []string
+		input    string
+		expected string
+		replaced int
+	}{
+		{
+			name:  "latest entry of the release is bumped",
+			paths: []string{"versions"},
+			input: fence + "yaml\n# releases\nversions:\n  - v0.1.3\n  - v0.2.0\n  - v0.2.1   # latest\n" + fence + "\n",
+			expected: fence + "yaml\n# releases\nversions:\n  - v0.1.3\n  - v0.2.0\n  - v0.2.2   # latest\n" +
+				fence + "\n",
+			replaced: 1,
+		},
+		{
+			name:     "flow sequence",
+			paths:    []string{"versions"},
+			input:    fence + "yml\nversions: [v0.1.3, 'v0.2.1']\nother: v0.2.1\n" + fence + "\n",
+			expected: fence + "yml\nversions: [v0.1.3, 'v0.2.2']\nother: v0.2.1\n" + fence + "\n",
+			replaced: 1,
+		},
+		{
+			name:  "nested path with the entries of other functions",
+			paths: []string{"catalog.versions"},
+			input: fence + "yaml\nversions:\n- apply-setters:v0.2.1\ncatalog:\n  name: kpt\n  versions:\n" +
+				"  - gcr.io/kpt-fn/set-labels:v0.2.0\n  - gcr.io/kpt-fn/apply-setters:v0.2.1\n" + fence + "\n",
+			expected: fence + "yaml\nversions:\n- apply-setters:v0.2.1\ncatalog:\n  name: kpt\n  versions:\n" +
+				"  - gcr.io/kpt-fn/set-labels:v0.2.0\n  - gcr.io/kpt-fn/apply-setters:v0.2.2\n" + fence + "\n",
+			replaced: 1,
+		},
+		{
+			name:     "current list",
+			paths:    []string{"versions"},
+			input:    fence + "yaml\nversions:\n  - v0.2.2\n" + fence + "\n",
+			expected: fence + "yaml\nversions:\n  - v0.2.2\n" + fence + "\n",
+		},
+		{
+			name:     "no entry of the release",
+			paths:    []string{"versions"},
+			input:    fence + "yaml\nversions:\n  - v0.1.3\n" + fence + "\n",
+			expected: fence + "yaml\nversions:\n  - v0.1.3\n" + fence + "\n",
+		},
+		{
+			name:     "other paths and code blocks are untouched",
+			paths:    []string{"releases"},
+			input:    fence + "yaml\nversions:\n  - v0.2.1\n" + fence + "\n" + fence + "\nreleases:\n  - v0.2.1\n" + fence + "\n",
+			expected: fence + "yaml\nversions:\n  - v0.2.1\n" + fence + "\n" + fence + "\nreleases:\n  - v0.2.1\n" + fence + "\n",
+		},
+		{
+			name:     "invalid YAML",
+			paths:    []string{"versions"},
+			input:    fence + "yaml\nversions: [v0.2.1\n" + fence + "\n",
+			expected: fence + "yaml\nversions: [v0.2.1\n" + fence + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := &functionRelease{
+				FunctionName:       "apply-setters",
+				MinorVersion:       "v0.2",
+				LatestPatchVersion: "v0.2.2",
+				opts:               releaseOptions{YAMLVersionLists: tc.paths},
+			}
+			actual, count := fr.replaceYAMLVersionLists([]byte(tc.input))
+			if string(actual) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+			if count.Replaced != tc.replaced {
+				t.Errorf("expected %d replaced, got %d", tc.replaced, count.Replaced)
+			}
+		})
+	}
+}
+
+func TestReplaceVersionsYAMLVersionLists(t *testing.T) {
+	fence := "```"
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		Language:           "go",
+		LatestPatchVersion: "v0.2.2",
+		opts:               releaseOptions{YAMLVersionLists: []string{"versions", "catalog.versions"}},
+	}
+	// the other passes leave the earlier entries of the lists as the version
+	// history, and still pin the references outside of them
+	input := "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters:v0.2.0\n\n" +
+		fence + "yaml\nversions:\n  - gcr.io/kpt-fn/apply-setters:v0.2.0\n  - gcr.io/kpt-fn/apply-setters:v0.2.1\n" +
+		"  - apply-setters:v0.2.0\nimage: gcr.io/kpt-fn/apply-setters:v0.2.0\n" +
+		"catalog:\n  versions: [apply-setters:v0.2.0]\n" + fence + "\n"
+	expected := "$ kpt fn eval --image gcr.io/kpt-fn/apply-setters:v0.2.2\n\n" +
+		fence + "yaml\nversions:\n  - gcr.io/kpt-fn/apply-setters:v0.2.0\n  - gcr.io/kpt-fn/apply-setters:v0.2.2\n" +
+		"  - apply-setters:v0.2.0\nimage: gcr.io/kpt-fn/apply-setters:v0.2.2\n" +
+		"catalog:\n  versions: [apply-setters:v0.2.2]\n" + fence + "\n"
+	if actual, _ := fr.replaceVersions([]byte(input)); string(actual) != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestReplaceYAMLVersionListsSkippedWarning(t *testing.T) {
+	defer func(count int) { warningCount = count }(warningCount)
+	defer func(out *os.File) { levelWarn.out = out }(levelWarn.out)
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	levelWarn.out = f
+	warningCount = 0
+
+	fence := "```"
+	fr := &functionRelease{
+		FunctionName:       "apply-setters",
+		MinorVersion:       "v0.2",
+		LatestPatchVersion: "v0.2.2",
+		opts:               releaseOptions{YAMLVersionLists: []string{"versions"}},
+		docPath:            "README.md",
+	}
+	// the entry is an alias of a value outside the list
+	input := fence + "yaml\nlatest: &latest v0.2.1\nversions:\n  - v0.2.0\n  - *latest\n" + fence + "\n"
+	if actual, _ := fr.replaceYAMLVersionLists([]byte(input)); string(actual) != input {
+		t.Errorf("expected the list to be left as is, got %q", actual)
+	}
+	if warningCount != 1 {
+		t.Errorf("expected a warning of the skipped entry, got %d", warningCount)
+	}
+	if log := readFile(t, f.Name()); !strings.Contains(log, "versions list of README.md") {
+		t.Errorf("expected the key path and doc in the warning, got %q", log)
+	}
+}